@@ -0,0 +1,14 @@
+package example
+
+import (
+	"going/internal/apps"
+)
+
+func init() {
+	// Register this app with the framework
+	apps.Register(apps.AppConfig{
+		Name:   "example",
+		Routes: RegisterRoutes,
+		Models: []interface{}{&ExampleModel{}},
+	})
+}
@@ -0,0 +1,12 @@
+package example
+
+import (
+	"github.com/gorilla/mux"
+)
+
+// RegisterRoutes registers all routes for this app
+func RegisterRoutes(router *mux.Router) {
+	// Register your routes here
+	// Example:
+	// router.HandleFunc("/", handleExample).Methods("GET")
+}
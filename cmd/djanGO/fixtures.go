@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"going/internal/config"
+	"going/internal/database"
+	"going/internal/fixtures"
+)
+
+// runDumpData writes the rows of the models matching labels, or of every
+// registered model, to output or to stdout if output is empty
+func runDumpData(cfg *config.Config, labels []string, format, output string) error {
+	if output != "" && format == "" {
+		var err error
+		if format, err = fixtures.FormatFromPath(output); err != nil {
+			return err
+		}
+	}
+	if format == "" {
+		format = "json"
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	records, err := fixtures.Dump(db, labels)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if output != "" {
+		f, err = os.Create(output)
+		if err != nil {
+			return fmt.Errorf("error creating fixture file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := fixtures.Encode(w, records, format); err != nil {
+		return fmt.Errorf("error writing fixture: %w", err)
+	}
+	if f != nil {
+		// Writes can fail only when the file is closed, e.g. on a full disk
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error writing fixture: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Dumped %d object(s) to %s\n", len(records), output)
+	}
+	return nil
+}
+
+// runLoadData loads a JSON or YAML fixture file into the database
+func runLoadData(cfg *config.Config, path string) error {
+	format, err := fixtures.FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening fixture file: %w", err)
+	}
+	defer f.Close()
+
+	records, err := fixtures.Decode(f, format)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	count, err := fixtures.Load(db, records)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed %d object(s) from %s\n", count, path)
+	return nil
+}
@@ -1,26 +1,84 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	_ "going/apps"
 	app "going/internal/app"
 	"going/internal/config"
-	"github.com/gorilla/mux"
 )
 
 const (
 	configPath = "config/config.yaml"
+	envPath    = ".env"
 )
 
+// overrideFlag collects repeated -set key=value flags
+type overrideFlag map[string]string
+
+func (o overrideFlag) String() string {
+	return ""
+}
+
+func (o overrideFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	o[key] = val
+	return nil
+}
+
+// printConfig prints every config value with its source, masking secrets
+func printConfig(cfg *config.Config) {
+	values := cfg.Values()
+	paths := make([]string, 0, len(values))
+	for path := range values {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		value := values[path]
+		if isSecretPath(path) && value != "" {
+			value = "********"
+		}
+		fmt.Printf("%-28s = %-24s (%s)\n", path, value, cfg.Source(path))
+	}
+}
+
+// isSecretPath reports whether the value at path must not be printed
+func isSecretPath(path string) bool {
+	return strings.Contains(path, "secret") || strings.HasSuffix(path, ".password") || strings.HasSuffix(path, ".dsn")
+}
+
 func main() {
 	// Command line flags
 	initFlag := flag.Bool("init", false, "Initialize a new going project")
 	createAppFlag := flag.String("create-app", "", "Create a new app with the given name")
+	migrateFlag := flag.String("migrate", "", "Run migrations: up, down, to <version> or status")
+	stepsFlag := flag.Int("steps", 1, "Number of migrations to roll back with -migrate down")
+	dryRunFlag := flag.Bool("dry-run", false, "Print migration SQL instead of executing it")
+	makeMigrationsFlag := flag.Bool("makemigrations", false, "Create a migration from changes to registered models")
+	nameFlag := flag.String("name", "", "Name of the migration created by -makemigrations")
+	dumpDataFlag := flag.Bool("dumpdata", false, "Write the rows of the given app or app.model labels, or of every model, as a fixture")
+	formatFlag := flag.String("format", "", "Fixture format for -dumpdata: json or yaml (default from -output, else json)")
+	outputFlag := flag.String("output", "", "File written by -dumpdata (default stdout)")
+	loadDataFlag := flag.String("loaddata", "", "Load a JSON or YAML fixture file into the database")
+	seedFlag := flag.Bool("seed", false, "Run the seeders of the given apps, or of every app")
+	envFlag := flag.String("env", "", "Environment profile, selects config/config.<env>.yaml (default $GOING_ENV)")
+	checkFlag := flag.Bool("check", false, "Validate the configuration and exit")
+	showConfigFlag := flag.Bool("show-config", false, "Print the configuration and where each value came from")
+	overrides := overrideFlag{}
+	flag.Var(overrides, "set", "Override a config value, e.g. -set server.port=9000 (repeatable)")
 	flag.Parse()
 
 	switch {
@@ -39,11 +97,61 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.LoadConfig(configPath)
+	cfg, err := config.LoadWithOptions(config.Options{
+		Path:        configPath,
+		EnvFile:     envPath,
+		Overrides:   overrides,
+		Environment: *envFlag,
+	})
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if *checkFlag {
+		fmt.Printf("Configuration OK (environment: %s)\n", cfg.Environment)
+		return
+	}
+
+	if *showConfigFlag {
+		printConfig(cfg)
+		return
+	}
+
+	if *migrateFlag != "" {
+		if err := runMigrate(cfg, *migrateFlag, flag.Args(), *stepsFlag, *dryRunFlag); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if *makeMigrationsFlag {
+		if err := runMakeMigrations(cfg, *nameFlag); err != nil {
+			log.Fatalf("Failed to make migrations: %v", err)
+		}
+		return
+	}
+
+	if *dumpDataFlag {
+		if err := runDumpData(cfg, flag.Args(), *formatFlag, *outputFlag); err != nil {
+			log.Fatalf("Failed to dump data: %v", err)
+		}
+		return
+	}
+
+	if *loadDataFlag != "" {
+		if err := runLoadData(cfg, *loadDataFlag); err != nil {
+			log.Fatalf("Failed to load data: %v", err)
+		}
+		return
+	}
+
+	if *seedFlag {
+		if err := runSeed(cfg, flag.Args()); err != nil {
+			log.Fatalf("Seeding failed: %v", err)
+		}
+		return
+	}
+
 	// Initialize and start the application
 	application, err := app.NewApplication(cfg)
 	if err != nil {
@@ -55,7 +163,6 @@ func main() {
 	}
 }
 
-// initializeProject sets up a new going project structure
 // createApp creates a new app with the given name
 func createApp(appName string) error {
 	// Create app directory
@@ -64,23 +171,48 @@ func createApp(appName string) error {
 		return fmt.Errorf("error creating app directory: %w", err)
 	}
 
-	// Create models.go file
-	modelsContent := fmt.Sprintf(`package %s
+	if err := writeAppFiles(appDir, appName); err != nil {
+		return err
+	}
+
+	// Regenerate the apps index so the new app gets compiled in
+	return writeAppsIndex()
+}
+
+// writeAppFiles writes the app, models and routes files of a new app
+func writeAppFiles(appDir, appName string) error {
+	modelName := strings.Title(appName)
+
+	// Create app.go file
+	appContent := fmt.Sprintf(`package %s
 
 import (
-	"going/internal/database"
+	"going/internal/apps"
 )
 
-type %sModel struct {
-	ID   uint   ` + "`" + `gorm:"primaryKey"` + "`" + `
-	Name string ` + "`" + `gorm:"size:255"` + "`" + `
+func init() {
+	// Register this app with the framework
+	apps.Register(apps.AppConfig{
+		Name:   "%s",
+		Routes: RegisterRoutes,
+		Models: []interface{}{&%sModel{}},
+	})
 }
+`, appName, appName, modelName)
 
-func init() {
-	// Register your models here
-	database.RegisterModels(&%sModel{})
+	appPath := filepath.Join(appDir, "app.go")
+	if err := os.WriteFile(appPath, []byte(appContent), 0644); err != nil {
+		return fmt.Errorf("error creating app file: %w", err)
+	}
+
+	// Create models.go file
+	modelsContent := fmt.Sprintf(`package %s
+
+type %sModel struct {
+	ID   uint   `+"`"+`gorm:"primaryKey"`+"`"+`
+	Name string `+"`"+`gorm:"size:255"`+"`"+`
 }
-`, appName, strings.Title(appName), strings.Title(appName))
+`, appName, modelName)
 
 	modelsPath := filepath.Join(appDir, "models.go")
 	if err := os.WriteFile(modelsPath, []byte(modelsContent), 0644); err != nil {
@@ -91,16 +223,16 @@ func init() {
 	routesContent := fmt.Sprintf(`package %s
 
 import (
-	"net/http"
+	"github.com/gorilla/mux"
 )
 
 // RegisterRoutes registers all routes for this app
 func RegisterRoutes(router *mux.Router) {
 	// Register your routes here
 	// Example:
-	// router.HandleFunc("/%s", handle%s).Methods("GET")
+	// router.HandleFunc("/", handle%s).Methods("GET")
 }
-`, appName, appName, strings.Title(appName))
+`, appName, modelName)
 
 	routesPath := filepath.Join(appDir, "routes.go")
 	if err := os.WriteFile(routesPath, []byte(routesContent), 0644); err != nil {
@@ -110,6 +242,56 @@ func RegisterRoutes(router *mux.Router) {
 	return nil
 }
 
+// writeAppsIndex regenerates apps/all.go, which blank-imports every app
+// under apps/ so their init functions register them
+func writeAppsIndex() error {
+	entries, err := os.ReadDir("apps")
+	if err != nil {
+		return fmt.Errorf("error reading apps directory: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		goFiles, _ := filepath.Glob(filepath.Join("apps", entry.Name(), "*.go"))
+		if len(goFiles) == 0 {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("// Code generated by djanGO -create-app. DO NOT EDIT.\n\n")
+	b.WriteString("// Package apps imports every installed app so that its init function\n")
+	b.WriteString("// registers it with the framework.\n")
+	b.WriteString("package apps\n")
+	if len(names) > 0 {
+		b.WriteString("\nimport (\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "\t_ \"going/apps/%s\"\n", name)
+		}
+		b.WriteString(")\n")
+	}
+
+	if err := os.WriteFile(filepath.Join("apps", "all.go"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("error writing apps index: %w", err)
+	}
+
+	return nil
+}
+
+// generateSecret returns a random value suitable for session.secret
+func generateSecret() (string, error) {
+	b := make([]byte, 48)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func initializeProject() error {
 	// Create necessary directories
 	dirs := []string{
@@ -131,6 +313,12 @@ func initializeProject() error {
 	cfgPath := filepath.Join("config", "config.yaml")
 	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
 		cfg := config.DefaultConfig()
+		cfg.Debug = true
+		secret, err := generateSecret()
+		if err != nil {
+			return fmt.Errorf("error generating session secret: %w", err)
+		}
+		cfg.Session.Secret = secret
 		if err := cfg.Save(cfgPath); err != nil {
 			return fmt.Errorf("error creating default config: %w", err)
 		}
@@ -141,27 +329,9 @@ func initializeProject() error {
 		return fmt.Errorf("error creating example app: %w", err)
 	}
 
-	// Create a sample app file
-	sampleAppContent := `package example
-
-import (
-	"going/internal/database"
-)
-
-type ExampleModel struct {
-	ID   uint   ` + "`" + `gorm:"primaryKey"` + "`" + `
-	Name string ` + "`" + `gorm:"size:255"` + "`" + `
-}
-
-func init() {
-	// Register your models here
-	database.RegisterModels(&ExampleModel{})
-}
-`
-
-	if err := os.WriteFile("apps/example/models.go", []byte(sampleAppContent), 0644); err != nil {
-		return fmt.Errorf("error creating example app file: %w", err)
+	if err := writeAppFiles(filepath.Join("apps", "example"), "example"); err != nil {
+		return fmt.Errorf("error creating example app files: %w", err)
 	}
 
-	return nil
+	return writeAppsIndex()
 }
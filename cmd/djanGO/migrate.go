@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"going/internal/config"
+	"going/internal/database"
+	"going/internal/migrations"
+	"going/internal/signals"
+)
+
+const (
+	migrationsDir = "migrations"
+)
+
+// runMigrate executes a migrate subcommand: up, down, to or status
+func runMigrate(cfg *config.Config, action string, args []string, steps int, dryRun bool) error {
+	// Flag parsing stops at the version, so later flags would be ignored
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("flag %s must come before the version, e.g. -migrate to %s <version>", arg, arg)
+		}
+	}
+
+	migrator, db, err := openMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator.DryRun = dryRun
+
+	var count int
+	switch action {
+	case "up":
+		count, err = migrator.Up()
+	case "down":
+		count, err = migrator.Down(steps)
+	case "to":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: -migrate to <version>")
+		}
+		version, parseErr := strconv.ParseInt(args[0], 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("invalid migration version %q: %w", args[0], parseErr)
+		}
+		count, err = migrator.To(version)
+	case "status":
+		return printMigrationStatus(migrator)
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down, to or status)", action)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+	fmt.Printf("%d migration(s) run\n", count)
+
+	// Versioned migrations manage the default database only
+	models, err := db.ModelsFor(config.DefaultDatabase)
+	if err != nil {
+		return err
+	}
+	return signals.PostMigrate.Send(context.Background(), &signals.Event{
+		DB:       db.Default(),
+		Database: config.DefaultDatabase,
+		Models:   models,
+	})
+}
+
+// runMakeMigrations writes a migration for the differences between the
+// registered models and the live schema
+func runMakeMigrations(cfg *config.Config, name string) error {
+	migrator, db, err := openMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The live schema only reflects applied migrations
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if !st.Applied {
+			return fmt.Errorf("migration %s is not applied; run -migrate up first", st.Migration.ID())
+		}
+	}
+
+	// Versioned migrations manage the default database only
+	models, err := db.ModelsFor(config.DefaultDatabase)
+	if err != nil {
+		return err
+	}
+
+	changes, err := migrations.Detect(db.Default(), models)
+	if err != nil {
+		return err
+	}
+
+	if changes.Empty() {
+		fmt.Println("No changes detected")
+		return nil
+	}
+
+	path, err := migrations.Write(migrationsDir, cfg.Database.Driver, name, changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created migration %s\n", path)
+	return nil
+}
+
+// openMigrator connects to the database without auto-migrating models and
+// loads the migrations directory. The caller must close the database.
+func openMigrator(cfg *config.Config) (*migrations.Migrator, *database.DB, error) {
+	dbCfg := *cfg
+	dbCfg.Database.AutoMigrate = false
+
+	db, err := database.Open(&dbCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list, err := migrations.Load(migrationsDir, cfg.Database.Driver)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return migrations.NewMigrator(db.Default(), list), db, nil
+}
+
+// printMigrationStatus lists every migration with its applied state
+func printMigrationStatus(migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No migrations")
+		return nil
+	}
+
+	for _, st := range statuses {
+		mark := " "
+		if st.Applied {
+			mark = "X"
+		}
+		line := fmt.Sprintf("[%s] %s", mark, st.Migration.ID())
+		if st.Applied {
+			line += " (applied " + st.AppliedAt.Format("2006-01-02 15:04:05") + ")"
+		}
+		if st.Missing {
+			line += " (missing)"
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
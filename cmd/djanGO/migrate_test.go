@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"going/internal/apps"
+	"going/internal/config"
+	"going/internal/database"
+	"going/internal/migrations"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	// An app with a Go migration, as apps/all.go would import it
+	apps.Register(apps.AppConfig{
+		Name: "migratetest",
+		Migrations: []migrations.Migration{{
+			Version: 9001,
+			Name:    "create_go_migrated",
+			UpFunc: func(tx *gorm.DB) error {
+				return tx.Exec("CREATE TABLE go_migrated (id integer PRIMARY KEY)").Error
+			},
+			DownFunc: func(tx *gorm.DB) error {
+				return tx.Exec("DROP TABLE go_migrated").Error
+			},
+		}},
+	})
+}
+
+// chdir runs the rest of the test in dir, where the CLI looks for the
+// migrations directory
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestMigrateAppliesGoMigrations(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	if err := os.Mkdir(migrationsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"0001_create_sql_migrated.up.sql":   "CREATE TABLE sql_migrated (id integer PRIMARY KEY);",
+		"0001_create_sql_migrated.down.sql": "DROP TABLE sql_migrated;",
+	}
+	for name, sql := range files {
+		if err := os.WriteFile(filepath.Join(migrationsDir, name), []byte(sql), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = filepath.Join(dir, "data")
+	cfg.Database.LogLevel = "silent"
+
+	hasTable := func(table string) bool {
+		t.Helper()
+
+		db, err := database.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		return db.Default().Migrator().HasTable(table)
+	}
+
+	if err := runMigrate(cfg, "up", nil, 1, false); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if !hasTable("sql_migrated") || !hasTable("go_migrated") {
+		t.Fatal("migrate up did not apply both the SQL and the Go migration")
+	}
+
+	// The Go migration has the highest version, so it is rolled back first
+	if err := runMigrate(cfg, "down", nil, 1, false); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if hasTable("go_migrated") {
+		t.Error("migrate down did not roll back the Go migration")
+	}
+	if !hasTable("sql_migrated") {
+		t.Error("migrate down rolled back more than one migration")
+	}
+}
+
+func TestMigrateRejectsFlagsAfterVersion(t *testing.T) {
+	err := runMigrate(config.DefaultConfig(), "to", []string{"1", "-dry-run"}, 1, false)
+	if err == nil || !strings.Contains(err.Error(), "-dry-run must come before the version") {
+		t.Errorf("expected the trailing flag to be rejected, got %v", err)
+	}
+}
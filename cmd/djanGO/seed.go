@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"going/internal/apps"
+	"going/internal/config"
+	"going/internal/database"
+)
+
+// runSeed runs the Seed hook of the named apps, or of every app that has
+// one, in registration order
+func runSeed(cfg *config.Config, names []string) error {
+	selected := make([]apps.AppConfig, 0)
+	if len(names) == 0 {
+		for _, app := range apps.All() {
+			if app.Seed != nil {
+				selected = append(selected, app)
+			}
+		}
+	} else {
+		for _, name := range names {
+			app, ok := apps.Get(name)
+			if !ok {
+				return fmt.Errorf("unknown app: %s", name)
+			}
+			if app.Seed == nil {
+				return fmt.Errorf("app %s has no seeder", name)
+			}
+			selected = append(selected, app)
+		}
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("No seeders")
+		return nil
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, app := range selected {
+		if err := db.Default().Transaction(app.Seed); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+		fmt.Printf("Seeded %s\n", app.Name)
+	}
+	return nil
+}
@@ -1,141 +1,288 @@
 package app
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"going/internal/apps"
+	"going/internal/auth"
 	"going/internal/config"
 	"going/internal/database"
 	"going/internal/middleware"
 	"going/internal/session"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
+// Hook is a function run when the application starts or shuts down
+type Hook func(ctx context.Context) error
+
 type Application struct {
-	Config  *config.Config
-	DB      *sql.DB
-	Router  *mux.Router
-	Session *session.Manager
+	Config *config.Config
+	// DB is the default database connection
+	DB *gorm.DB
+	// Databases holds every connection, including named databases
+	Databases *database.DB
+	Router    *mux.Router
+	Session   *session.Manager
+	// Watcher publishes reloaded configs; nil unless reload_interval is set
+	Watcher *config.Watcher
+
+	startupHooks  []Hook
+	shutdownHooks []Hook
 }
 
-func NewApplication(cfg *config.Config) (*Application, error) {
+func NewApplication(cfg *config.Config) (app *Application, err error) {
 	// Initialize database
-	db, err := database.InitDB(cfg)
+	db, err := database.Open(cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize session manager
-	sessionManager := session.NewManager(cfg)
+	sessionManager, err := session.NewManager(cfg, db.Default())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Release the session manager and database if the rest of the setup fails
+	defer func() {
+		if err != nil {
+			sessionManager.Close()
+			db.Close()
+		}
+	}()
 
 	// Create router
 	router := mux.NewRouter()
 
-	return &Application{
-		Config:  cfg,
-		DB:      db,
-		Router:  router,
-		Session: sessionManager,
-	}, nil
-}
+	// Make this application's database available to request handlers
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(database.NewContext(r.Context(), db)))
+		})
+	})
+
+	// Load the session and the logged-in user for every request
+	router.Use(sessionManager.Middleware)
+	router.Use(auth.Middleware(cfg.Auth.LoginURL))
+
+	// Run each unsafe request in a transaction
+	if cfg.Database.AtomicRequests {
+		router.Use(database.AtomicRequests)
+	}
+
+	// Report the number of queries per request to spot N+1 patterns
+	if cfg.Debug {
+		router.Use(countQueries)
+	}
+
+	// Let installed apps finish their setup
+	if err := readyApps(db.Default()); err != nil {
+		return nil, err
+	}
+
+	app = &Application{
+		Config:    cfg,
+		DB:        db.Default(),
+		Databases: db,
+		Router:    router,
+		Session:   sessionManager,
+	}
+
+	// Close the database last, after everything else has shut down
+	app.OnShutdown(func(ctx context.Context) error {
+		return db.Close()
+	})
+
+	// Stop the session janitor
+	app.OnShutdown(func(ctx context.Context) error {
+		return sessionManager.Close()
+	})
+
+	// Watch the config files and apply changes live
+	if cfg.ReloadInterval > 0 {
+		watcher, err := config.NewWatcher(cfg, time.Duration(cfg.ReloadInterval)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		watcher.Subscribe(sessionManager.Reload)
+		watcher.Subscribe(db.Reload)
+		app.Watcher = watcher
+
+		app.OnStartup(func(ctx context.Context) error {
+			watcher.Start()
+			return nil
+		})
+		app.OnShutdown(func(ctx context.Context) error {
+			return watcher.Close()
+		})
+	}
 
-func (app *Application) Run() error {
 	// Register routes
 	app.registerRoutes()
 
-	// Create a new router with the logging middleware
-	loggedRouter := middleware.LoggingMiddleware(app.Router)
+	return app, nil
+}
+
+// OnStartup registers a hook that runs before the server starts listening.
+// Hooks run in registration order.
+func (app *Application) OnStartup(hook Hook) {
+	app.startupHooks = append(app.startupHooks, hook)
+}
+
+// OnShutdown registers a hook that runs after the server has stopped.
+// Hooks run in reverse registration order.
+func (app *Application) OnShutdown(hook Hook) {
+	app.shutdownHooks = append(app.shutdownHooks, hook)
+}
+
+// Run starts the server and blocks until it fails or receives SIGINT or
+// SIGTERM, in which case in-flight requests are drained before returning
+func (app *Application) Run() error {
+	// Create a new router with the logging and request ID middleware
+	loggedRouter := middleware.RequestIDMiddleware(middleware.LoggingMiddleware(app.Router))
 
-	// Start the server
 	serverAddr := app.Config.Server.Host + ":" + app.Config.Server.Port
-	log.Printf("Starting server on %s\n", serverAddr)
-	return http.ListenAndServe(serverAddr, loggedRouter)
+	server := &http.Server{
+		Addr:    serverAddr,
+		Handler: loggedRouter,
+	}
+
+	// Run startup hooks
+	for _, hook := range app.startupHooks {
+		if err := hook(context.Background()); err != nil {
+			return errors.Join(fmt.Errorf("startup hook failed: %w", err), app.runShutdownHooks(context.Background()))
+		}
+	}
+
+	// Trap termination signals
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	// Start the server
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s\n", serverAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var runErr error
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			runErr = err
+		}
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down\n", sig)
+	}
+
+	// Stop accepting connections and drain in-flight requests
+	ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		runErr = errors.Join(runErr, fmt.Errorf("server shutdown: %w", err))
+	}
+
+	// Give the hooks their own timeout, as draining may have used up ctx
+	hookCtx, hookCancel := context.WithTimeout(context.Background(), app.shutdownTimeout())
+	defer hookCancel()
+
+	return errors.Join(runErr, app.runShutdownHooks(hookCtx))
+}
+
+// runShutdownHooks runs every shutdown hook in reverse order, collecting errors
+func (app *Application) runShutdownHooks(ctx context.Context) error {
+	var errs []error
+	for i := len(app.shutdownHooks) - 1; i >= 0; i-- {
+		if err := app.shutdownHooks[i](ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook failed: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shutdownTimeout returns how long to wait for in-flight requests
+func (app *Application) shutdownTimeout() time.Duration {
+	if app.Config.Server.ShutdownTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(app.Config.Server.ShutdownTimeout) * time.Second
 }
 
 func (app *Application) registerRoutes() {
 	// Register base routes
 	app.Router.HandleFunc("/", app.handleHome).Methods("GET")
 
+	// Register auth routes
+	if app.Config.Auth.LoginURL != "" {
+		app.Router.HandleFunc(app.Config.Auth.LoginURL, auth.LoginFormHandler).Methods("GET")
+		app.Router.HandleFunc(app.Config.Auth.LoginURL, auth.LoginHandler).Methods("POST")
+	}
+	if app.Config.Auth.LogoutURL != "" {
+		app.Router.HandleFunc(app.Config.Auth.LogoutURL, auth.LogoutHandler).Methods("POST")
+	}
+
 	// Register app routes
 	if err := app.registerAppRoutes(); err != nil {
 		log.Printf("Warning: Failed to register app routes: %v", err)
 	}
 }
 
-// registerAppRoutes finds and registers routes from all apps
+// registerAppRoutes mounts the routes of every registered app
 func (app *Application) registerAppRoutes() error {
-	appsDir := "apps"
-	entries, err := os.ReadDir(appsDir)
-	if err != nil {
-		return fmt.Errorf("error reading apps directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	for _, cfg := range apps.All() {
+		if cfg.Routes == nil {
 			continue
 		}
 
-		appName := entry.Name()
-		appPath := filepath.Join(appsDir, appName)
-		routesFile := filepath.Join(appPath, "routes.go")
-
-		// Check if routes.go exists
-		if _, err := os.Stat(routesFile); os.IsNotExist(err) {
-			continue
-		}
+		// Create a subrouter for this app
+		router := app.Router.PathPrefix("/" + cfg.Name).Subrouter()
 
-		// Import the app package
-		pkgPath := fmt.Sprintf("going/apps/%s", appName)
-		appPkg, err := importPackage(pkgPath)
-		if err != nil {
-			log.Printf("Error importing app %s: %v", appName, err)
-			continue
-		}
+		// Let the app register its routes on the subrouter
+		cfg.Routes(router)
 
-		// Look for RegisterRoutes function
-		registerFunc, err := findRegisterRoutesFunc(appPkg, appName)
-		if err != nil {
-			log.Printf("Error in app %s: %v", appName, err)
-			continue
-		}
+		log.Printf("Registered routes for app: %s", cfg.Name)
+	}
 
-		// Create a subrouter for this app
-		router := app.Router.PathPrefix("/" + appName).Subrouter()
+	return nil
+}
 
-		// Call the RegisterRoutes function with the subrouter
-		if err := registerFunc(router); err != nil {
-			log.Printf("Error registering routes for app %s: %v", appName, err)
+// readyApps calls the Ready hook of every registered app
+func readyApps(db *gorm.DB) error {
+	for _, cfg := range apps.All() {
+		if cfg.Ready == nil {
 			continue
 		}
-
-		log.Printf("Registered routes for app: %s", appName)
+		if err := cfg.Ready(db); err != nil {
+			return fmt.Errorf("app %s: %w", cfg.Name, err)
+		}
 	}
 
 	return nil
 }
 
-// importPackage is a helper to import a package by path
-func importPackage(path string) (interface{}, error) {
-	// This is a simplified version - in a real implementation, you might use
-	// golang.org/x/tools/go/packages or similar to load packages at runtime
-	// For now, we'll use a simple approach that works with the existing code
-	return nil, nil
-}
+// countQueries logs how many database queries each request ran. Queries
+// are only counted when run with the request's context, e.g.
+// db.WithContext(r.Context()).
+func countQueries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := database.WithQueryCounter(r.Context())
+		next.ServeHTTP(w, r.WithContext(ctx))
 
-// findRegisterRoutesFunc looks for a RegisterRoutes function in the package
-func findRegisterRoutesFunc(pkg interface{}, appName string) (func(*mux.Router) error, error) {
-	// In a real implementation, this would use reflection to find and call the function
-	// For now, we'll return a no-op function
-	return func(router *mux.Router) error {
-		// This will be replaced with actual route registration
-		return nil
-	}, nil
+		log.Printf("[%s] %s %s: %d queries",
+			middleware.RequestIDFromContext(ctx), r.Method, r.URL.Path, database.QueryCount(ctx))
+	})
 }
 
 func (app *Application) handleHome(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"going/internal/auth"
+	"going/internal/config"
+	"going/internal/database"
+	"going/internal/session"
+)
+
+// newTestApplication returns an application on a fresh SQLite database in
+// a temporary directory, with every registered model migrated
+func newTestApplication(t *testing.T, configure func(cfg *config.Config)) *Application {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Debug = true
+	cfg.Database.Path = t.TempDir()
+	cfg.Database.AutoMigrate = true
+	cfg.Database.LogLevel = "silent"
+	if configure != nil {
+		configure(cfg)
+	}
+
+	app, err := NewApplication(cfg)
+	if err != nil {
+		t.Fatalf("NewApplication: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := app.runShutdownHooks(context.Background()); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+	return app
+}
+
+func TestLoginWithAtomicRequestsAndDatabaseSessions(t *testing.T) {
+	app := newTestApplication(t, func(cfg *config.Config) {
+		cfg.Database.AtomicRequests = true
+		cfg.Session.Backend = "database"
+	})
+
+	ctx := database.NewContext(context.Background(), app.Databases)
+	if _, err := auth.CreateUser(ctx, "alice", "alice@example.com", "s3cret-passw0rd"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	login := func() {
+		t.Helper()
+
+		start := time.Now()
+		resp, err := client.Post(server.URL+"/login", "application/json",
+			strings.NewReader(`{"username": "alice", "password": "s3cret-passw0rd"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("login returned %d", resp.StatusCode)
+		}
+		// Waiting out the busy timeout means the store blocked on the lock
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("login took %s", elapsed)
+		}
+	}
+
+	login()
+	// Logging in again cycles the existing session, deleting its row
+	login()
+
+	var count int64
+	if err := app.DB.Model(&session.Record{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the old session to be replaced, found %d sessions", count)
+	}
+
+	resp, err := client.Post(server.URL+"/logout", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("logout returned %d", resp.StatusCode)
+	}
+
+	if err := app.DB.Model(&session.Record{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected logout to delete the session, found %d sessions", count)
+	}
+}
+
+func TestLoginRequiredRedirectServesForm(t *testing.T) {
+	app := newTestApplication(t, nil)
+	app.Router.Handle("/private", auth.RequireLogin(http.HandlerFunc(app.handleHome))).Methods("GET")
+
+	server := httptest.NewServer(app.Router)
+	defer server.Close()
+
+	// The client follows the redirect to the login URL
+	resp, err := http.Get(server.URL + "/private?page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login page returned %d", resp.StatusCode)
+	}
+	if resp.Request.URL.Path != "/login" {
+		t.Errorf("redirected to %s", resp.Request.URL)
+	}
+	if !strings.Contains(string(body), `<form method="post" action="/login">`) ||
+		!strings.Contains(string(body), `name="next" value="/private?page=2"`) {
+		t.Errorf("unexpected login page:\n%s", body)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/login", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("JSON login page returned %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,84 @@
+package apps
+
+import (
+	"fmt"
+	"sync"
+
+	"going/internal/database"
+	"going/internal/migrations"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// AppConfig describes an installed app
+type AppConfig struct {
+	// Name is the app label; its routes are mounted under /<Name>
+	Name string
+	// Routes registers the app's handlers on its subrouter
+	Routes func(router *mux.Router)
+	// Models are registered for migration along with the app
+	Models []interface{}
+	// Migrations are Go migrations of the app, applied by the migrate
+	// command along with the SQL files of the migrations directory
+	Migrations []migrations.Migration
+	// Ready is called with the application's database once it has been
+	// initialized
+	Ready func(db *gorm.DB) error
+	// Seed fills the database with initial or demo data. It is run by the
+	// seed command, in a transaction per app.
+	Seed func(db *gorm.DB) error
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make([]AppConfig, 0)
+)
+
+// Register installs an app. It is meant to be called from an app's init
+// function and panics if the name is empty or already registered.
+func Register(cfg AppConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cfg.Name == "" {
+		panic("apps: Register called with an empty app name")
+	}
+	for _, existing := range registry {
+		if existing.Name == cfg.Name {
+			panic(fmt.Sprintf("apps: Register called twice for app %q", cfg.Name))
+		}
+	}
+
+	if len(cfg.Models) > 0 {
+		database.RegisterModels(cfg.Models...)
+	}
+	for _, m := range cfg.Migrations {
+		migrations.Register(m)
+	}
+
+	registry = append(registry, cfg)
+}
+
+// All returns every registered app in registration order
+func All() []AppConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]AppConfig, len(registry))
+	copy(list, registry)
+	return list
+}
+
+// Get returns the registered app with the given name
+func Get(name string) (AppConfig, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, cfg := range registry {
+		if cfg.Name == name {
+			return cfg, true
+		}
+	}
+	return AppConfig{}, false
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"going/internal/apps"
+	"going/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a username or password is wrong
+	// or the account is inactive
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// verifyPassword checks a password against a hash; tests replace it to
+// count the calls
+var verifyPassword = VerifyPassword
+
+// dummyHash is checked when the username doesn't exist, so unknown
+// usernames take as long to reject as wrong passwords
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("dummy password")
+	if err != nil {
+		panic(fmt.Sprintf("failed to hash dummy password: %v", err))
+	}
+	return hash
+})
+
+// defaultActions are the permissions generated for every registered model
+var defaultActions = []string{"add", "change", "delete", "view"}
+
+func init() {
+	// Register auth as a built-in app
+	apps.Register(apps.AppConfig{
+		Name:   "auth",
+		Models: []interface{}{&Permission{}, &Group{}, &User{}},
+		Ready:  SyncPermissions,
+	})
+}
+
+// Authenticate returns the active user matching the given credentials
+func Authenticate(ctx context.Context, username, password string) (*User, error) {
+	db, err := database.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = preload(db).Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Hash anyway, so the response time doesn't reveal which usernames exist
+		verifyPassword(password, dummyHash())
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading user: %w", err)
+	}
+
+	ok, err := user.CheckPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying password: %w", err)
+	}
+	if !ok || !user.IsActive {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &user, nil
+}
+
+// GetUser loads a user and their permissions by ID
+func GetUser(ctx context.Context, id uint) (*User, error) {
+	db, err := database.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := preload(db).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateUser creates a user with a hashed password
+func CreateUser(ctx context.Context, username, email, password string) (*User, error) {
+	db, err := database.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Username: username,
+		Email:    email,
+		IsActive: true,
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+
+	if err := db.Create(user).Error; err != nil {
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SyncPermissions creates the add, change, delete and view permissions of
+// every registered model. It does nothing until the permission table exists.
+func SyncPermissions(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Permission{}) {
+		return nil
+	}
+
+	for _, model := range database.Models() {
+		app, name := database.ModelLabel(model)
+		for _, action := range defaultActions {
+			perm := Permission{
+				Name:     fmt.Sprintf("Can %s %s", action, name),
+				App:      app,
+				Codename: action + "_" + name,
+			}
+			err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&perm).Error
+			if err != nil {
+				return fmt.Errorf("error creating permission %s: %w", perm, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// preload adds the associations HasPerm relies on
+func preload(db *gorm.DB) *gorm.DB {
+	return db.Preload("Permissions").Preload("Groups.Permissions")
+}
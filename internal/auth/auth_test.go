@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"going/internal/database"
+	"going/internal/testing/factory"
+)
+
+func TestCreateInactiveUser(t *testing.T) {
+	db := factory.DB(t)
+
+	user := &User{Username: "disabled", IsActive: false}
+	if err := user.SetPassword("s3cret-passw0rd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Default().Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	var stored User
+	if err := db.Default().First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsActive {
+		t.Error("inactive user was stored as active")
+	}
+
+	ctx := database.NewContext(context.Background(), db)
+	if _, err := Authenticate(ctx, "disabled", "s3cret-passw0rd"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected inactive user to be rejected, got %v", err)
+	}
+}
+
+func TestCreateUserIsActive(t *testing.T) {
+	ctx := database.NewContext(context.Background(), factory.DB(t))
+
+	user, err := CreateUser(ctx, "alice", "alice@example.com", "s3cret-passw0rd")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if !user.IsActive {
+		t.Error("new user is not active")
+	}
+
+	got, err := Authenticate(ctx, "alice", "s3cret-passw0rd")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticated user %d, want %d", got.ID, user.ID)
+	}
+}
+
+func TestAuthenticateUnknownUserHashes(t *testing.T) {
+	ctx := database.NewContext(context.Background(), factory.DB(t))
+	if _, err := CreateUser(ctx, "alice", "alice@example.com", "s3cret-passw0rd"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	var calls int
+	verify := verifyPassword
+	verifyPassword = func(password, hash string) (bool, error) {
+		calls++
+		return verify(password, hash)
+	}
+	t.Cleanup(func() { verifyPassword = verify })
+
+	for _, username := range []string{"alice", "nobody"} {
+		calls = 0
+		if _, err := Authenticate(ctx, username, "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: expected invalid credentials, got %v", username, err)
+		}
+		if calls != 1 {
+			t.Errorf("%s: password hasher called %d times, want 1", username, calls)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// credentials is the body accepted by LoginHandler
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginForm is the page served by LoginFormHandler; it posts back to the
+// login URL
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Log in</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="next" value="{{.Next}}">
+<label>Username <input name="username" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// LoginFormHandler serves the login URL to GET requests, such as the
+// redirects of RequireLogin. HTML clients get a login form that posts to
+// LoginHandler, or are redirected to "next" if already logged in; JSON
+// clients receive 401.
+func LoginFormHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeRedirect(r.URL.Query().Get("next"))
+	if wantsJSON(r) {
+		writeError(w, r, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	if CurrentUser(r) != nil {
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	loginForm.Execute(w, map[string]string{
+		"Action": r.URL.Path,
+		"Next":   next,
+	})
+}
+
+// LoginHandler authenticates a POSTed username and password, sent as a form
+// or as JSON. Requests from other sites are rejected, see sameOrigin. HTML clients are redirected to the "next" parameter, or to /;
+// JSON clients receive the user's ID and username.
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	// Stop other sites logging visitors into an account of their choosing
+	if !sameOrigin(r) {
+		writeError(w, r, http.StatusForbidden, "cross-site request rejected")
+		return
+	}
+
+	var creds credentials
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	} else {
+		creds.Username = r.PostFormValue("username")
+		creds.Password = r.PostFormValue("password")
+	}
+
+	user, err := Authenticate(r.Context(), creds.Username, creds.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	if err := Login(w, r, user); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":       user.ID,
+			"username": user.Username,
+		})
+		return
+	}
+
+	http.Redirect(w, r, safeRedirect(r.FormValue("next")), http.StatusFound)
+}
+
+// LogoutHandler logs the user out. HTML clients are redirected to the
+// "next" parameter, or to /; JSON clients receive 204 No Content.
+// Requests from other sites are rejected, as in LoginHandler.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		writeError(w, r, http.StatusForbidden, "cross-site request rejected")
+		return
+	}
+
+	if err := Logout(w, r); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "logout failed")
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	http.Redirect(w, r, safeRedirect(r.FormValue("next")), http.StatusFound)
+}
+
+// safeRedirect only allows local paths, to avoid open redirects
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// sameOrigin reports whether r was sent from a page on this host, guarding
+// against cross-site request forgery. Browsers send Origin, or at least
+// Referer, with form posts; requests with neither, e.g. from scripts, are
+// allowed.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Referer()
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	return err == nil && u.Host == r.Host
+}
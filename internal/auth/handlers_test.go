@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"no headers", nil, true},
+		{"same origin", map[string]string{"Origin": "http://example.com"}, true},
+		{"same referer", map[string]string{"Referer": "http://example.com/login?next=/"}, true},
+		{"cross-site origin", map[string]string{"Origin": "https://evil.test"}, false},
+		{"cross-site referer", map[string]string{"Referer": "https://evil.test/form"}, false},
+		{"opaque origin", map[string]string{"Origin": "null"}, false},
+		{"origin wins over referer", map[string]string{"Origin": "https://evil.test", "Referer": "http://example.com/"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://example.com/login", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := sameOrigin(r); got != tt.want {
+				t.Errorf("sameOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossSiteLoginAndLogoutRejected(t *testing.T) {
+	form := url.Values{"username": {"alice"}, "password": {"s3cret-passw0rd"}}
+	for _, handler := range []http.HandlerFunc{LoginHandler, LogoutHandler} {
+		r := httptest.NewRequest("POST", "http://example.com/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Origin", "https://evil.test")
+		w := httptest.NewRecorder()
+
+		handler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("cross-site POST returned %d, want 403", w.Code)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"going/internal/database"
+	"going/internal/session"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionKey is the session value holding the logged-in user's ID
+const SessionKey = "_auth_user_id"
+
+var (
+	// ErrNoMiddleware is returned when Login or Logout is called on a
+	// request that did not pass through the session and auth middleware
+	ErrNoMiddleware = errors.New("session or auth middleware not installed")
+)
+
+type contextKey struct{}
+
+// requestState is the per-request auth state stored in the context
+type requestState struct {
+	loginURL string
+	request  *http.Request
+
+	once sync.Once
+	user *User
+}
+
+// Middleware makes the user referenced by the session available through
+// CurrentUser and enables Login and Logout. It must run after
+// session.Manager.Middleware. The user is loaded lazily on first access.
+// Unauthenticated HTML requests rejected by RequireLogin or
+// RequirePermission are redirected to loginURL.
+func Middleware(loginURL string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := &requestState{
+				loginURL: loginURL,
+				request:  r,
+			}
+			ctx := context.WithValue(r.Context(), contextKey{}, state)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CurrentUser returns the logged-in user, or nil for anonymous requests
+func CurrentUser(r *http.Request) *User {
+	state := stateFrom(r)
+	if state == nil {
+		return nil
+	}
+
+	state.once.Do(func() {
+		state.user = state.loadUser()
+	})
+	return state.user
+}
+
+// Login stores the user in the session, cycling the session ID to prevent
+// session fixation, and updates the user's last login time. The session
+// cookie is written with the response.
+func Login(w http.ResponseWriter, r *http.Request, user *User) error {
+	state := stateFrom(r)
+	sess := session.FromContext(r.Context())
+	if state == nil || sess == nil {
+		return ErrNoMiddleware
+	}
+
+	if err := sess.Cycle(); err != nil {
+		return err
+	}
+	sess.Set(SessionKey, strconv.FormatUint(uint64(user.ID), 10))
+
+	now := time.Now()
+	user.LastLogin = &now
+	if db, err := database.Conn(r.Context()); err == nil {
+		if err := db.Model(user).Update("last_login", now).Error; err != nil {
+			log.Printf("Error updating last login for user %d: %v", user.ID, err)
+		}
+	}
+
+	state.once.Do(func() {})
+	state.user = user
+	return nil
+}
+
+// Logout flushes the session, which clears the session cookie
+func Logout(w http.ResponseWriter, r *http.Request) error {
+	state := stateFrom(r)
+	sess := session.FromContext(r.Context())
+	if state == nil || sess == nil {
+		return ErrNoMiddleware
+	}
+
+	if err := sess.Flush(); err != nil {
+		return err
+	}
+
+	state.once.Do(func() {})
+	state.user = nil
+	return nil
+}
+
+// RequireLogin rejects anonymous requests: HTML requests are redirected to
+// the login URL and JSON requests get 401 Unauthorized
+func RequireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CurrentUser(r) == nil {
+			unauthorized(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission rejects requests from users without perm. Anonymous
+// requests are handled as in RequireLogin; logged-in users get 403 Forbidden.
+func RequirePermission(perm string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := CurrentUser(r)
+			if user == nil {
+				unauthorized(w, r)
+				return
+			}
+			if !user.HasPerm(perm) {
+				writeError(w, r, http.StatusForbidden, "permission denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loadUser resolves the session's user ID to an active user
+func (s *requestState) loadUser() *User {
+	sess := session.FromContext(s.request.Context())
+	if sess == nil {
+		return nil
+	}
+
+	value, _ := sess.Get(SessionKey)
+	id, ok := sessionUserID(value)
+	if !ok {
+		return nil
+	}
+
+	user, err := GetUser(s.request.Context(), id)
+	if err != nil || !user.IsActive {
+		return nil
+	}
+	return user
+}
+
+// sessionUserID parses the stored user ID, which is kept as a string so it
+// survives any session serialization format
+func sessionUserID(value interface{}) (uint, bool) {
+	str, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// unauthorized redirects HTML requests to the login URL and answers JSON
+// requests with 401
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	state := stateFrom(r)
+	if wantsJSON(r) || state == nil || state.loginURL == "" {
+		writeError(w, r, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	target := state.loginURL + "?next=" + url.QueryEscape(r.URL.RequestURI())
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// writeError writes an error as JSON or plain text depending on the request
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// wantsJSON reports whether the client expects a JSON response
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") ||
+		r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
+
+func stateFrom(r *http.Request) *requestState {
+	state, _ := r.Context().Value(contextKey{}).(*requestState)
+	return state
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"time"
+)
+
+// Permission grants the right to perform an action, e.g. blog.add_post
+type Permission struct {
+	ID       uint   `gorm:"primaryKey"`
+	Name     string `gorm:"size:255"`
+	App      string `gorm:"size:100;uniqueIndex:idx_auth_permission_app_codename"`
+	Codename string `gorm:"size:100;uniqueIndex:idx_auth_permission_app_codename"`
+}
+
+// TableName overrides the GORM table name
+func (Permission) TableName() string {
+	return "auth_permission"
+}
+
+// String returns the permission in app.codename form
+func (p Permission) String() string {
+	return p.App + "." + p.Codename
+}
+
+// Group is a named set of permissions that users can belong to
+type Group struct {
+	ID          uint         `gorm:"primaryKey"`
+	Name        string       `gorm:"size:150;uniqueIndex"`
+	Permissions []Permission `gorm:"many2many:auth_group_permissions"`
+}
+
+// TableName overrides the GORM table name
+func (Group) TableName() string {
+	return "auth_group"
+}
+
+// User is an account that can log in
+type User struct {
+	ID          uint   `gorm:"primaryKey"`
+	Username    string `gorm:"size:150;uniqueIndex;not null"`
+	Email       string `gorm:"size:254"`
+	Password    string `gorm:"size:255"` // Argon2id hash
+	IsActive    bool   // CreateUser activates new users
+	IsStaff     bool
+	IsSuperuser bool
+	LastLogin   *time.Time
+	DateJoined  time.Time    `gorm:"autoCreateTime"`
+	Groups      []Group      `gorm:"many2many:auth_user_groups"`
+	Permissions []Permission `gorm:"many2many:auth_user_permissions"`
+}
+
+// TableName overrides the GORM table name
+func (User) TableName() string {
+	return "auth_user"
+}
+
+// SetPassword hashes and stores a new password
+func (u *User) SetPassword(password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+	return nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func (u *User) CheckPassword(password string) (bool, error) {
+	if u.Password == "" {
+		return false, nil
+	}
+	return verifyPassword(password, u.Password)
+}
+
+// HasPerm reports whether the user has a permission in app.codename form.
+// Active superusers have every permission. The user's Permissions and
+// Groups.Permissions must be preloaded, as done by Authenticate and GetUser.
+func (u *User) HasPerm(perm string) bool {
+	if !u.IsActive {
+		return false
+	}
+	if u.IsSuperuser {
+		return true
+	}
+
+	for _, p := range u.Permissions {
+		if p.String() == perm {
+			return true
+		}
+	}
+	for _, g := range u.Groups {
+		for _, p := range g.Permissions {
+			if p.String() == perm {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -1,90 +1,353 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type DatabaseConfig struct {
-	Driver   string `yaml:"driver"`
-	Name     string `yaml:"name"`
-	Path     string `yaml:"path"`
-	LogLevel string `yaml:"log_level"`
+	Driver             string `yaml:"driver"`               // sqlite3, postgres or mysql
+	Name               string `yaml:"name"`                 // file name for sqlite3, database name otherwise
+	Path               string `yaml:"path"`                 // sqlite3 only
+	LogLevel           string `yaml:"log_level"`            // silent, error, warn or info
+	SlowQueryThreshold int    `yaml:"slow_query_threshold"` // in milliseconds, 0 disables
+	RedactParams       bool   `yaml:"redact_params"`        // hide query parameters in logs
+	AutoMigrate        bool   `yaml:"auto_migrate"`         // development only
+	AtomicRequests     bool   `yaml:"atomic_requests"`      // a transaction per unsafe request
+
+	// Connection pool; 0 means no limit
+	MaxOpenConns    int `yaml:"max_open_conns"`
+	MaxIdleConns    int `yaml:"max_idle_conns"`
+	ConnMaxLifetime int `yaml:"conn_max_lifetime"` // in seconds
+
+	SQLite SQLiteConfig `yaml:"sqlite"`
+
+	// Server connection for postgres and mysql. A raw DSN, if set, is
+	// used instead for any driver.
+	DSN      string            `yaml:"dsn,omitempty"`
+	Host     string            `yaml:"host,omitempty"`
+	Port     string            `yaml:"port,omitempty"`
+	User     string            `yaml:"user,omitempty"`
+	Password string            `yaml:"password,omitempty"`
+	SSLMode  string            `yaml:"sslmode,omitempty"` // postgres only
+	Params   map[string]string `yaml:"params,omitempty"`  // extra driver options
+
+	// Replicas names databases that serve reads for this one
+	Replicas []string `yaml:"replicas,omitempty"`
+	// Tables are routed to this database instead of the default one
+	Tables []string `yaml:"tables,omitempty"`
+}
+
+// SQLiteConfig holds the pragmas applied to every SQLite connection
+type SQLiteConfig struct {
+	JournalMode string `yaml:"journal_mode"` // delete, truncate, persist, memory, wal or off
+	BusyTimeout int    `yaml:"busy_timeout"` // in milliseconds
+	ForeignKeys bool   `yaml:"foreign_keys"`
+	Synchronous string `yaml:"synchronous"` // off, normal, full or extra
+	TxLock      string `yaml:"tx_lock"`     // deferred, immediate or exclusive
 }
 
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port string `yaml:"port"`
+	Host            string `yaml:"host"`
+	Port            string `yaml:"port"`
+	ShutdownTimeout int    `yaml:"shutdown_timeout"` // in seconds
 }
 
 type SessionConfig struct {
-	Name     string `yaml:"name"`
-	Secret   string `yaml:"secret"`
-	Lifetime int    `yaml:"lifetime"` // in minutes
+	Name       string   `yaml:"name"`
+	Secret     string   `yaml:"secret"`
+	OldSecrets []string `yaml:"old_secrets,omitempty"` // still accepted, for rotation
+	Lifetime   int      `yaml:"lifetime"`              // in minutes
+	Backend    string   `yaml:"backend"`               // memory, database, filesystem or cookie
+	Path       string   `yaml:"path"`                  // directory for the filesystem backend
+	GCInterval int      `yaml:"gc_interval"`           // in seconds
+}
+
+type AuthConfig struct {
+	LoginURL  string `yaml:"login_url"`
+	LogoutURL string `yaml:"logout_url"`
 }
 
 type Config struct {
+	// Environment names the active profile, e.g. development or production
+	Environment string `yaml:"environment"`
+	// Debug enables development behavior such as insecure cookies
+	Debug bool `yaml:"debug"`
+
 	Database DatabaseConfig `yaml:"database"`
 	Server   ServerConfig   `yaml:"server"`
 	Session  SessionConfig  `yaml:"session"`
+	Auth     AuthConfig     `yaml:"auth"`
+
+	// Databases holds additional named connections; unset values are taken
+	// from the database section
+	Databases map[string]*DatabaseConfig `yaml:"databases,omitempty"`
+
+	// ReloadInterval is how often, in seconds, config files are checked for
+	// changes; 0 disables hot reloading
+	ReloadInterval int `yaml:"reload_interval"`
+
+	// sources records where each value came from, keyed by path
+	sources map[string]string
+	// options and files are used to reload the configuration
+	options Options
+	files   []string
+	// refs holds the original secret references, keyed by path
+	refs map[string]string
+}
+
+// EnvPrefix prefixes the environment variables that override config values
+const EnvPrefix = "GOING_"
+
+// EnvVar selects the environment profile when Options.Environment is empty
+const EnvVar = EnvPrefix + "ENV"
+
+// Options controls how LoadWithOptions layers configuration sources
+type Options struct {
+	// Path is the YAML config file
+	Path string
+	// EnvFile is an optional .env file; it is skipped if missing
+	EnvFile string
+	// Overrides are applied last, keyed by path, e.g. server.port
+	Overrides map[string]string
+	// Environment selects the config.<env>.yaml overlay. When empty,
+	// GOING_ENV is used, then the base file's environment key.
+	Environment string
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	return &Config{
+		Environment: "development",
 		Database: DatabaseConfig{
-			Driver:   "sqlite3",
-			Name:     "django.db",
-			Path:     "./data",
-			LogLevel: "info",
+			Driver:             "sqlite3",
+			Name:               "django.db",
+			Path:               "./data",
+			LogLevel:           "warn",
+			SlowQueryThreshold: 200,
+			RedactParams:       true,
+			MaxIdleConns:       2,
+			SQLite: SQLiteConfig{
+				JournalMode: "wal",
+				BusyTimeout: 5000,
+				ForeignKeys: true,
+				Synchronous: "normal",
+				TxLock:      "immediate",
+			},
 		},
 		Server: ServerConfig{
-			Host: "0.0.0.0",
-			Port: "8080",
+			Host:            "0.0.0.0",
+			Port:            "8080",
+			ShutdownTimeout: 30,
 		},
 		Session: SessionConfig{
-			Name:     "django_session",
-			Secret:   "change-this-secret-key",
-			Lifetime: 120, // 2 hours
+			Name:       "django_session",
+			Secret:     "change-this-secret-key",
+			Lifetime:   120, // 2 hours
+			Backend:    "memory",
+			Path:       "./data/sessions",
+			GCInterval: 60,
+		},
+		Auth: AuthConfig{
+			LoginURL:  "/login",
+			LogoutURL: "/logout",
 		},
 	}
 }
 
-// LoadConfig loads configuration from a YAML file
+// LoadConfig loads configuration from a YAML file, then applies overrides
+// from a .env file in the working directory and from GOING_* environment
+// variables
 func LoadConfig(path string) (*Config, error) {
+	return LoadWithOptions(Options{Path: path, EnvFile: ".env"})
+}
+
+// LoadWithOptions builds the configuration in layers, each overriding the
+// previous one: defaults, the YAML file, its config.<env>.yaml overlay, the
+// .env file, GOING_* environment variables and finally explicit overrides
+// such as CLI flags. Variables are named after the YAML path, e.g.
+// GOING_SERVER_PORT for server.port. YAML files may pull in shared
+// fragments with a top-level include key.
+func LoadWithOptions(opts Options) (*Config, error) {
 	config := DefaultConfig()
 
-	// Read the config file
-	data, err := os.ReadFile(path)
+	// Environment variables take precedence over the .env file
+	env := make(map[string]string)
+	envSource := make(map[string]string)
+	if opts.EnvFile != "" {
+		vars, err := readDotEnv(opts.EnvFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error loading env file: %w", err)
+		}
+		for key, value := range vars {
+			env[key] = value
+			envSource[key] = "env file " + opts.EnvFile
+		}
+	}
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, EnvPrefix) {
+			env[key] = value
+			envSource[key] = "env " + key
+		}
+	}
+
+	// Read the config file and its includes
+	loader := newYAMLLoader()
+	if err := loader.load(opts.Path); err != nil {
+		return nil, err
+	}
+
+	// Select the environment and merge its overlay
+	environment := opts.Environment
+	environmentSource := "flag"
+	if environment == "" {
+		environment = env[EnvVar]
+		environmentSource = envSource[EnvVar]
+	}
+	if environment == "" {
+		environment, _ = loader.merged["environment"].(string)
+		environmentSource = loader.sources["environment"]
+	}
+	if environment == "" {
+		environment = config.Environment
+		environmentSource = "default"
+	}
+
+	overlay := overlayPath(opts.Path, environment)
+	if _, err := os.Stat(overlay); err == nil {
+		if err := loader.load(overlay); err != nil {
+			return nil, err
+		}
+	}
+	loader.merged["environment"] = environment
+	loader.sources["environment"] = environmentSource
+
+	// Reject keys that don't map to a config field
+	errs := unknownKeys(loader.merged, loader.sources)
+
+	// Unmarshal the merged YAML into our Config struct
+	data, err := yaml.Marshal(loader.merged)
 	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+		return nil, fmt.Errorf("error merging config files: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(len(errs) == 0)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	config.sources = loader.sources
+	config.options = opts
+	config.files = append(loader.files, overlay)
+	if opts.EnvFile != "" {
+		config.files = append(config.files, opts.EnvFile)
 	}
 
-	// Unmarshal the YAML into our Config struct
-	if err := yaml.Unmarshal(data, config); err != nil {
+	// Override the database section before the named databases inherit
+	// from it, then override the named databases themselves
+	if err := config.applyOverrides(env, envSource, opts.Overrides, false); err != nil {
+		return nil, err
+	}
+	if err := config.inheritDatabases(loader.merged["databases"]); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
+	if err := config.applyOverrides(env, envSource, opts.Overrides, true); err != nil {
+		return nil, err
+	}
+
+	// Resolve secret references such as ${env:SESSION_SECRET}
+	errs = append(errs, config.resolveSecrets()...)
+
+	// Report every problem at once
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
-	// Ensure the database directory exists
-	if err := os.MkdirAll(config.Database.Path, 0755); err != nil {
-		return nil, fmt.Errorf("error creating database directory: %w", err)
+	// Ensure the database directories exist
+	for _, d := range append([]*DatabaseConfig{&config.Database}, config.namedDatabases()...) {
+		if d.Driver == "sqlite3" && d.DSN == "" {
+			if err := os.MkdirAll(d.Path, 0755); err != nil {
+				return nil, fmt.Errorf("error creating database directory: %w", err)
+			}
+		}
 	}
 
 	return config, nil
 }
 
-// SaveConfig saves the current configuration to a YAML file
+// applyOverrides sets fields from GOING_* variables and then from explicit
+// overrides. named selects the databases.* fields, which only exist once
+// inheritDatabases has run; otherwise every other field is set.
+func (c *Config) applyOverrides(env, envSource, overrides map[string]string, named bool) error {
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		if strings.HasPrefix(f.path, "databases.") != named {
+			continue
+		}
+		name := envName(f.path)
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := setField(f, value); err != nil {
+			return fmt.Errorf("error applying %s: %w", name, err)
+		}
+		c.sources[f.path] = envSource[name]
+	}
+
+	for path, value := range overrides {
+		if strings.HasPrefix(path, "databases.") != named {
+			continue
+		}
+		f, ok := c.lookupField(path)
+		if !ok {
+			return fmt.Errorf("unknown config key: %s", path)
+		}
+		if err := setField(f, value); err != nil {
+			return fmt.Errorf("error applying override: %w", err)
+		}
+		c.sources[path] = "flag"
+	}
+	return nil
+}
+
+// Source describes where the value at path came from: "default", a file,
+// an environment variable or "flag"
+func (c *Config) Source(path string) string {
+	if source, ok := c.sources[path]; ok {
+		return source
+	}
+	return "default"
+}
+
+// Values returns every config value keyed by path, formatted as they would
+// be given in an environment variable
+func (c *Config) Values() map[string]string {
+	values := make(map[string]string)
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		values[f.path] = formatField(f)
+	}
+	return values
+}
+
+// Save saves the configuration to a YAML file. Values loaded from secret
+// references are written as the references, never as resolved secrets.
 func (c *Config) Save(path string) error {
 	// Ensure the directory exists
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return fmt.Errorf("error creating config directory: %w", err)
 	}
 
-	// Marshal the config to YAML
-	data, err := yaml.Marshal(c)
+	// Marshal the config to YAML, keeping secret references unresolved
+	data, err := yaml.Marshal(c.unresolved())
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %w", err)
 	}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDatabase is the name of the connection configured by the database
+// section
+const DefaultDatabase = "default"
+
+// inheritDatabases decodes each named database over a copy of the database
+// section, so only the values that differ need to be given. raw is the
+// merged databases section of the YAML files.
+func (c *Config) inheritDatabases(raw interface{}) error {
+	sections, _ := raw.(map[string]interface{})
+	if len(sections) == 0 {
+		return nil
+	}
+
+	c.Databases = make(map[string]*DatabaseConfig, len(sections))
+	for name, section := range sections {
+		data, err := yaml.Marshal(section)
+		if err != nil {
+			return err
+		}
+
+		d := c.Database
+		d.Params = make(map[string]string, len(c.Database.Params))
+		for key, value := range c.Database.Params {
+			d.Params[key] = value
+		}
+		d.Replicas = nil
+		d.Tables = nil
+		if section != nil {
+			if err := yaml.Unmarshal(data, &d); err != nil {
+				return fmt.Errorf("databases.%s: %w", name, err)
+			}
+		}
+		c.Databases[name] = &d
+	}
+
+	// Report inherited values as coming from the database section
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		rest, ok := strings.CutPrefix(f.path, "databases.")
+		if !ok {
+			continue
+		}
+		if _, ok := c.sources[f.path]; ok {
+			continue
+		}
+		_, key, _ := strings.Cut(rest, ".")
+		if source, ok := c.sources["database."+key]; ok {
+			c.sources[f.path] = "database." + key + ", " + source
+		}
+	}
+
+	return nil
+}
+
+// databaseNames returns the names of the named databases, sorted
+func (c *Config) databaseNames() []string {
+	names := make([]string, 0, len(c.Databases))
+	for name := range c.Databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedDatabases returns the named databases, sorted by name
+func (c *Config) namedDatabases() []*DatabaseConfig {
+	list := make([]*DatabaseConfig, 0, len(c.Databases))
+	for _, name := range c.databaseNames() {
+		list = append(list, c.Databases[name])
+	}
+	return list
+}
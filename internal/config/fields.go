@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// field is a leaf config value addressed by its YAML path, e.g. server.port
+type field struct {
+	path  string
+	value reflect.Value
+}
+
+// fields lists every leaf field of the config struct v. Maps of struct
+// pointers, such as databases, contribute a section per key.
+func fields(v reflect.Value, prefix string) []field {
+	list := make([]field, 0)
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			list = append(list, fields(fv, path)...)
+			continue
+		}
+		if isStructMap(fv.Type()) {
+			keys := fv.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+			for _, key := range keys {
+				list = append(list, fields(fv.MapIndex(key).Elem(), path+"."+key.String())...)
+			}
+			continue
+		}
+		list = append(list, field{path: path, value: fv})
+	}
+
+	return list
+}
+
+// isStructMap reports whether t is a map of named sections
+func isStructMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String &&
+		t.Elem().Kind() == reflect.Pointer && t.Elem().Elem().Kind() == reflect.Struct
+}
+
+// lookupField returns the field at path, e.g. server.port
+func (c *Config) lookupField(path string) (field, bool) {
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		if f.path == path {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// setField parses raw into the field's type. Lists are comma-separated and
+// maps are comma-separated key=value pairs.
+func setField(f field, raw string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", f.path, raw)
+		}
+		f.value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", f.path, raw)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		if f.value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported list type", f.path)
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		if f.value.Type() != reflect.TypeOf(map[string]string(nil)) {
+			return fmt.Errorf("%s: unsupported map type", f.path)
+		}
+		items := make(map[string]string)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%s: invalid entry %q, expected key=value", f.path, item)
+			}
+			items[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.path, f.value.Type())
+	}
+	return nil
+}
+
+// formatField renders a field's value the way setField parses it
+func formatField(f field) string {
+	if f.value.Kind() == reflect.Slice {
+		items := make([]string, f.value.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(f.value.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	if f.value.Kind() == reflect.Map {
+		items := make([]string, 0, f.value.Len())
+		iter := f.value.MapRange()
+		for iter.Next() {
+			items = append(items, fmt.Sprint(iter.Key().Interface())+"="+fmt.Sprint(iter.Value().Interface()))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// envName maps a config path to its environment variable,
+// e.g. server.port to GOING_SERVER_PORT
+func envName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level YAML key listing fragments to merge in
+const includeKey = "include"
+
+// overlayPath returns the per-environment overlay of a config file,
+// e.g. config/config.production.yaml for config/config.yaml
+func overlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// yamlLoader deep-merges YAML files into a single mapping, remembering
+// which file set each leaf
+type yamlLoader struct {
+	merged  map[string]interface{}
+	sources map[string]string
+	stack   []string
+	// files lists every file loaded, including includes
+	files []string
+}
+
+func newYAMLLoader() *yamlLoader {
+	return &yamlLoader{
+		merged:  make(map[string]interface{}),
+		sources: make(map[string]string),
+	}
+}
+
+// load merges a file into the result. The file's includes are merged
+// first, so the file's own values override them. Include paths are
+// relative to the including file.
+func (l *yamlLoader) load(path string) error {
+	for _, p := range l.stack {
+		if p == path {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(l.stack, path), " -> "))
+		}
+	}
+	l.stack = append(l.stack, path)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+	l.files = append(l.files, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	includes, err := includeList(doc[includeKey])
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	delete(doc, includeKey)
+
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		if err := l.load(inc); err != nil {
+			return err
+		}
+	}
+
+	l.merge(l.merged, doc, "", path)
+	return nil
+}
+
+// merge copies src into dst, descending into nested mappings
+func (l *yamlLoader) merge(dst, src map[string]interface{}, prefix, file string) {
+	for key, value := range src {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			existing, ok := dst[key].(map[string]interface{})
+			if !ok {
+				existing = make(map[string]interface{})
+				dst[key] = existing
+			}
+			l.merge(existing, nested, path, file)
+			continue
+		}
+
+		dst[key] = value
+		l.sources[path] = "file " + file
+	}
+}
+
+// includeList accepts a single path or a list of paths
+func includeList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s entries must be file paths", includeKey)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("%s must be a path or a list of paths", includeKey)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resolver turns the part of a reference ${scheme:ref} after the colon into
+// its value
+type Resolver func(ref string) (string, error)
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]Resolver{
+		"env":    resolveEnv,
+		"file":   resolveFile,
+		"base64": resolveBase64,
+	}
+)
+
+// RegisterResolver makes values of the form "${scheme:ref}" in string config
+// fields resolve through r at load time, e.g. for a secrets manager
+func RegisterResolver(scheme string, r Resolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+
+	resolvers[scheme] = r
+}
+
+// resolveEnv reads an environment variable, which must be set
+func resolveEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveFile reads a file such as a mounted Docker or Kubernetes secret,
+// without its trailing newline
+func resolveFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveBase64 decodes standard base64
+func resolveBase64(encoded string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64: %w", err)
+	}
+	return string(data), nil
+}
+
+// resolveReference resolves value if it is a whole ${scheme:ref} reference
+// with a registered scheme. Plain values such as a "file:" SQLite DSN are
+// left alone.
+func resolveReference(value string) (resolved, scheme string, err error) {
+	if !strings.HasPrefix(value, "${") || !strings.HasSuffix(value, "}") {
+		return value, "", nil
+	}
+	scheme, ref, ok := strings.Cut(value[2:len(value)-1], ":")
+	if !ok {
+		return value, "", nil
+	}
+
+	resolversMu.RLock()
+	resolver, ok := resolvers[scheme]
+	resolversMu.RUnlock()
+	if !ok {
+		return value, "", nil
+	}
+
+	resolved, err = resolver(ref)
+	if err != nil {
+		return "", scheme, err
+	}
+	return resolved, scheme, nil
+}
+
+// resolveSecrets replaces references in every string field with their
+// values, remembering the references so Save can write them back
+func (c *Config) resolveSecrets() ValidationError {
+	var errs ValidationError
+	c.refs = make(map[string]string)
+
+	resolve := func(path string, v reflect.Value) {
+		resolved, scheme, err := resolveReference(v.String())
+		if scheme == "" {
+			return
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Path: path, Message: "cannot resolve " + strconv.Quote(v.String()) + ": " + err.Error()})
+			return
+		}
+		c.refs[path] = v.String()
+		c.sources[path] = c.Source(path) + ", resolved from " + scheme
+		v.SetString(resolved)
+	}
+
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		switch {
+		case f.value.Kind() == reflect.String:
+			resolve(f.path, f.value)
+		case f.value.Kind() == reflect.Slice && f.value.Type().Elem().Kind() == reflect.String:
+			for i := 0; i < f.value.Len(); i++ {
+				resolve(f.path+"["+strconv.Itoa(i)+"]", f.value.Index(i))
+			}
+		}
+	}
+
+	return errs
+}
+
+// unresolved returns a copy of the config with resolved secrets replaced by
+// their original references
+func (c *Config) unresolved() *Config {
+	out := *c
+
+	// Don't write through to the original's named databases
+	if c.Databases != nil {
+		out.Databases = make(map[string]*DatabaseConfig, len(c.Databases))
+		for name, d := range c.Databases {
+			copied := *d
+			out.Databases[name] = &copied
+		}
+	}
+
+	for _, f := range fields(reflect.ValueOf(&out).Elem(), "") {
+		if f.value.Kind() == reflect.Slice {
+			// Don't write through to the original's backing array
+			copied := reflect.MakeSlice(f.value.Type(), f.value.Len(), f.value.Len())
+			reflect.Copy(copied, f.value)
+			f.value.Set(copied)
+		}
+
+		if ref, ok := c.refs[f.path]; ok {
+			f.value.SetString(ref)
+		}
+		if f.value.Kind() == reflect.Slice {
+			for i := 0; i < f.value.Len(); i++ {
+				if ref, ok := c.refs[f.path+"["+strconv.Itoa(i)+"]"]; ok {
+					f.value.Index(i).SetString(ref)
+				}
+			}
+		}
+	}
+
+	return &out
+}
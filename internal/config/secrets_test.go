@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a YAML config file to a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "session")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_OLD_SECRET", "from-env")
+
+	path := writeConfig(t, `
+debug: true
+session:
+  secret: ${file:`+secretFile+`}
+  old_secrets:
+    - ${env:TEST_OLD_SECRET}
+    - ${base64:c2VjcmV0}
+    - plain
+`)
+	cfg, err := LoadWithOptions(Options{Path: path})
+	if err != nil {
+		t.Fatalf("LoadWithOptions: %v", err)
+	}
+
+	if cfg.Session.Secret != "from-file" {
+		t.Errorf("secret = %q, want %q", cfg.Session.Secret, "from-file")
+	}
+	want := []string{"from-env", "secret", "plain"}
+	if strings.Join(cfg.Session.OldSecrets, ",") != strings.Join(want, ",") {
+		t.Errorf("old_secrets = %q, want %q", cfg.Session.OldSecrets, want)
+	}
+	if source := cfg.Source("session.secret"); !strings.HasSuffix(source, "resolved from file") {
+		t.Errorf("source = %q", source)
+	}
+
+	// Save writes the references back, never the secrets
+	out := filepath.Join(t.TempDir(), "saved.yaml")
+	if err := cfg.Save(out); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "from-file") || !strings.Contains(string(data), "${env:TEST_OLD_SECRET}") {
+		t.Errorf("saved config exposes secrets or lost references:\n%s", data)
+	}
+}
+
+func TestPlainValuesAreNotResolved(t *testing.T) {
+	tests := []string{
+		"file:data/going.db?cache=shared",
+		"file:data/going.db",
+		"env:DATABASE_DSN",
+		"base64:c2VjcmV0",
+		"${unknown:ref}",
+		"${NOT_A_REFERENCE}",
+	}
+	for _, dsn := range tests {
+		t.Run(dsn, func(t *testing.T) {
+			t.Setenv("GOING_DATABASE_DSN", dsn)
+
+			cfg, err := LoadWithOptions(Options{Path: writeConfig(t, "debug: true\n")})
+			if err != nil {
+				t.Fatalf("LoadWithOptions: %v", err)
+			}
+			if cfg.Database.DSN != dsn {
+				t.Errorf("dsn = %q, want %q", cfg.Database.DSN, dsn)
+			}
+		})
+	}
+}
+
+func TestUnresolvableReference(t *testing.T) {
+	path := writeConfig(t, `
+debug: true
+session:
+  secret: ${env:TEST_UNSET_SECRET}
+`)
+	os.Unsetenv("TEST_UNSET_SECRET")
+
+	_, err := LoadWithOptions(Options{Path: path})
+	if err == nil || !strings.Contains(err.Error(), "TEST_UNSET_SECRET is not set") {
+		t.Fatalf("expected an unset variable error, got %v", err)
+	}
+}
@@ -0,0 +1,389 @@
+package config
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// knownDrivers are the supported database drivers
+	knownDrivers = []string{"sqlite3", "postgres", "mysql"}
+	// knownSSLModes are the postgres sslmode values
+	knownSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+	// knownJournalModes, knownSynchronous and knownTxLocks are the accepted
+	// SQLite settings
+	knownJournalModes = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+	knownSynchronous  = []string{"off", "normal", "full", "extra"}
+	knownTxLocks      = []string{"deferred", "immediate", "exclusive"}
+
+	// knownLogLevels are the supported database log levels
+	knownLogLevels = []string{"silent", "error", "warn", "info"}
+	// knownSessionBackends are the supported session stores
+	knownSessionBackends = []string{"memory", "database", "filesystem", "cookie"}
+)
+
+const (
+	// minSecretLength is the shortest session secret accepted outside debug mode
+	minSecretLength = 32
+	// minSecretStrength is the estimated strength, in bits, required of the
+	// session secret outside debug mode
+	minSecretStrength = 128
+	// minSecretDistinct is the fewest distinct characters a session secret
+	// may contain, to catch repeated patterns
+	minSecretDistinct = 8
+)
+
+// FieldError is a problem with the config value at Path, e.g. session.secret
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	lines := make([]string, len(e))
+	for i, fe := range e {
+		lines[i] = "  " + fe.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+// Validate checks every section of the configuration and returns a
+// ValidationError listing all problems, or nil
+func (c *Config) Validate() error {
+	var errs ValidationError
+	add := func(path, message string) {
+		errs = append(errs, FieldError{Path: path, Message: message})
+	}
+
+	if c.Environment == "" {
+		add("environment", "must not be empty")
+	}
+	if c.ReloadInterval < 0 {
+		add("reload_interval", "must not be negative")
+	}
+
+	// Database
+	validateDatabase("database", c.Database, add)
+	for _, name := range c.databaseNames() {
+		path := "databases." + name
+		if name == DefaultDatabase {
+			add(path, "is reserved for the database section")
+			continue
+		}
+		validateDatabase(path, *c.Databases[name], add)
+	}
+	c.checkDistinctDatabases(add)
+	if len(c.Database.Tables) > 0 {
+		add("database.tables", "can only be set for named databases")
+	}
+	c.checkReplicas("database", c.Database, add)
+	for _, name := range c.databaseNames() {
+		c.checkReplicas("databases."+name, *c.Databases[name], add)
+	}
+
+	// Server
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port", "must be a number between 1 and 65535, got "+strconv.Quote(c.Server.Port))
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		add("server.shutdown_timeout", "must not be negative")
+	}
+
+	// Session
+	if c.Session.Name == "" || strings.ContainsAny(c.Session.Name, " \t;,=\"") {
+		add("session.name", "must be a valid cookie name")
+	}
+	if c.Session.Lifetime <= 0 {
+		add("session.lifetime", "must be greater than 0")
+	}
+	if !contains(knownSessionBackends, c.Session.Backend) {
+		add("session.backend", "unknown backend "+strconv.Quote(c.Session.Backend)+"; expected one of "+strings.Join(knownSessionBackends, ", "))
+	}
+	if c.Session.Backend == "filesystem" && c.Session.Path == "" {
+		add("session.path", "must not be empty with the filesystem backend")
+	}
+	if c.Session.GCInterval <= 0 {
+		add("session.gc_interval", "must be greater than 0")
+	}
+	if msg := checkSecret(c.Session.Secret, c.Debug); msg != "" {
+		add("session.secret", msg)
+	}
+	for i, secret := range c.Session.OldSecrets {
+		if secret == "" {
+			add("session.old_secrets["+strconv.Itoa(i)+"]", "must not be empty")
+		}
+	}
+
+	// Auth
+	if c.Auth.LoginURL != "" && !strings.HasPrefix(c.Auth.LoginURL, "/") {
+		add("auth.login_url", "must be a path starting with /")
+	}
+	if c.Auth.LogoutURL != "" && !strings.HasPrefix(c.Auth.LogoutURL, "/") {
+		add("auth.logout_url", "must be a path starting with /")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkSecret returns a problem with the session secret, or "". Strength
+// is only enforced outside debug mode.
+func checkSecret(secret string, debug bool) string {
+	if secret == "" {
+		return "must not be empty"
+	}
+	if debug {
+		return ""
+	}
+	if strings.Contains(secret, "change-this") {
+		return "is still the placeholder value"
+	}
+	if len(secret) < minSecretLength {
+		return "must be at least " + strconv.Itoa(minSecretLength) + " characters"
+	}
+	if strength(secret) < minSecretStrength {
+		return "is too weak; use a long random value"
+	}
+	if distinct(secret) < minSecretDistinct {
+		return "is too predictable; use a long random value"
+	}
+	return ""
+}
+
+// strength estimates the bits in s as its length times the bits per
+// character of the alphabet it draws from, so a random 32-character hex
+// key counts as 128 bits
+func strength(s string) float64 {
+	var lower, upper, digit, other bool
+	hex := true
+	n := 0
+	for _, r := range s {
+		n++
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+			hex = hex && r <= 'f'
+		case r >= 'A' && r <= 'Z':
+			upper = true
+			hex = hex && r <= 'F'
+		case r >= '0' && r <= '9':
+			digit = true
+		default:
+			other = true
+			hex = false
+		}
+	}
+
+	// Hex keys use a single case; digits alone are decimal
+	alphabet := 0
+	switch {
+	case hex && lower != upper:
+		alphabet = 16
+	default:
+		if lower {
+			alphabet += 26
+		}
+		if upper {
+			alphabet += 26
+		}
+		if digit {
+			alphabet += 10
+		}
+		if other {
+			alphabet += 32
+		}
+	}
+	return float64(n) * math.Log2(float64(alphabet))
+}
+
+// distinct counts the distinct characters in s
+func distinct(s string) int {
+	seen := make(map[rune]bool)
+	for _, r := range s {
+		seen[r] = true
+	}
+	return len(seen)
+}
+
+// validateDatabase checks a database section, reporting paths under prefix
+func validateDatabase(prefix string, d DatabaseConfig, add func(path, message string)) {
+	if !contains(knownDrivers, d.Driver) {
+		add(prefix+".driver", "unknown driver "+strconv.Quote(d.Driver)+"; expected one of "+strings.Join(knownDrivers, ", "))
+	}
+	if d.Name == "" && d.DSN == "" {
+		add(prefix+".name", "must not be empty")
+	}
+	if d.Driver == "sqlite3" && d.Path == "" && d.DSN == "" {
+		add(prefix+".path", "must not be empty")
+	}
+	if d.Port != "" {
+		if port, err := strconv.Atoi(d.Port); err != nil || port < 1 || port > 65535 {
+			add(prefix+".port", "must be a number between 1 and 65535, got "+strconv.Quote(d.Port))
+		}
+	}
+	if d.SSLMode != "" {
+		if d.Driver != "postgres" {
+			add(prefix+".sslmode", "is only supported by the postgres driver")
+		} else if !contains(knownSSLModes, d.SSLMode) {
+			add(prefix+".sslmode", "unknown mode "+strconv.Quote(d.SSLMode)+"; expected one of "+strings.Join(knownSSLModes, ", "))
+		}
+	}
+	if !contains(knownLogLevels, d.LogLevel) {
+		add(prefix+".log_level", "unknown level "+strconv.Quote(d.LogLevel)+"; expected one of "+strings.Join(knownLogLevels, ", "))
+	}
+	if d.SlowQueryThreshold < 0 {
+		add(prefix+".slow_query_threshold", "must not be negative")
+	}
+	if d.MaxOpenConns < 0 {
+		add(prefix+".max_open_conns", "must not be negative")
+	}
+	if d.MaxIdleConns < 0 {
+		add(prefix+".max_idle_conns", "must not be negative")
+	}
+	if d.ConnMaxLifetime < 0 {
+		add(prefix+".conn_max_lifetime", "must not be negative")
+	}
+	if d.Driver == "sqlite3" {
+		sqlite := d.SQLite
+		if sqlite.JournalMode != "" && !contains(knownJournalModes, strings.ToLower(sqlite.JournalMode)) {
+			add(prefix+".sqlite.journal_mode", "unknown mode "+strconv.Quote(sqlite.JournalMode)+"; expected one of "+strings.Join(knownJournalModes, ", "))
+		}
+		if sqlite.BusyTimeout < 0 {
+			add(prefix+".sqlite.busy_timeout", "must not be negative")
+		}
+		if sqlite.Synchronous != "" && !contains(knownSynchronous, strings.ToLower(sqlite.Synchronous)) {
+			add(prefix+".sqlite.synchronous", "unknown value "+strconv.Quote(sqlite.Synchronous)+"; expected one of "+strings.Join(knownSynchronous, ", "))
+		}
+		if sqlite.TxLock != "" && !contains(knownTxLocks, strings.ToLower(sqlite.TxLock)) {
+			add(prefix+".sqlite.tx_lock", "unknown value "+strconv.Quote(sqlite.TxLock)+"; expected one of "+strings.Join(knownTxLocks, ", "))
+		}
+	}
+}
+
+// checkReplicas reports replicas that don't name another database, or that
+// have replicas of their own
+func (c *Config) checkReplicas(prefix string, d DatabaseConfig, add func(path, message string)) {
+	for i, replica := range d.Replicas {
+		path := prefix + ".replicas[" + strconv.Itoa(i) + "]"
+		r, ok := c.Databases[replica]
+		switch {
+		case !ok || replica == DefaultDatabase:
+			add(path, "unknown database "+strconv.Quote(replica))
+		case prefix == "databases."+replica:
+			add(path, "a database cannot be its own replica")
+		case r.Driver != d.Driver:
+			add(path, "must use the same driver as the primary, "+d.Driver)
+		case len(r.Replicas) > 0 || len(r.Tables) > 0:
+			add(path, "a replica cannot have replicas or tables of its own")
+		}
+	}
+}
+
+// checkDistinctDatabases reports named databases that open the same
+// database as the database section or another named database. Named
+// databases inherit name, path and host, so one that doesn't override them
+// would silently use the default database.
+func (c *Config) checkDistinctDatabases(add func(path, message string)) {
+	seen := map[string]string{databaseTarget(c.Database): "database"}
+	for _, name := range c.databaseNames() {
+		target := databaseTarget(*c.Databases[name])
+		if target == "" {
+			continue
+		}
+		if other, ok := seen[target]; ok {
+			add("databases."+name, "opens the same database as "+other+"; set its name, path, host or dsn")
+			continue
+		}
+		seen[target] = "databases." + name
+	}
+}
+
+// databaseTarget identifies the database d opens, or returns "" for a
+// private in-memory SQLite database
+func databaseTarget(d DatabaseConfig) string {
+	switch {
+	case d.DSN != "":
+		return d.Driver + " " + d.DSN
+	case d.Driver == "sqlite3" && d.Name == ":memory:":
+		return ""
+	case d.Driver == "sqlite3":
+		return d.Driver + " " + filepath.Join(d.Path, d.Name)
+	default:
+		return d.Driver + " " + d.Host + ":" + d.Port + "/" + d.Name
+	}
+}
+
+// unknownKeys reports YAML keys that do not map to a config field
+func unknownKeys(merged map[string]interface{}, sources map[string]string) ValidationError {
+	// Give the probe a section for every named database found
+	probe := DefaultConfig()
+	if databases, ok := merged["databases"].(map[string]interface{}); ok {
+		probe.Databases = make(map[string]*DatabaseConfig)
+		for name := range databases {
+			probe.Databases[name] = &DatabaseConfig{}
+		}
+	}
+
+	known := make(map[string]bool)
+	sections := map[string]bool{"databases": true}
+	for _, f := range fields(reflect.ValueOf(probe).Elem(), "") {
+		known[f.path] = true
+		parts := strings.Split(f.path, ".")
+		for i := 1; i < len(parts); i++ {
+			sections[strings.Join(parts[:i], ".")] = true
+		}
+	}
+
+	var errs ValidationError
+	var walk func(m map[string]interface{}, prefix string)
+	walk = func(m map[string]interface{}, prefix string) {
+		for key, value := range m {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if nested, ok := value.(map[string]interface{}); ok && sections[path] {
+				walk(nested, path)
+				continue
+			}
+			if known[path] {
+				continue
+			}
+
+			message := "unknown key"
+			if source, ok := sources[path]; ok {
+				message += " (" + source + ")"
+			}
+			errs = append(errs, FieldError{Path: path, Message: message})
+		}
+	}
+	walk(merged, "")
+
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Path < errs[j].Path
+	})
+	return errs
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		debug  bool
+		want   string
+	}{
+		{"hex key", "9f86d081884c7d659a2feaa0c55ad015", false, ""},
+		{"upper case hex key", "9F86D081884C7D659A2FEAA0C55AD015", false, ""},
+		{"base64 key", "q8Zt3vJ0xW1mYp9LrK4aB7nC2dE5fG6h", false, ""},
+		{"passphrase", "correct horse battery staple, twice over", false, ""},
+		{"empty", "", true, "must not be empty"},
+		{"weak in debug", "dev", true, ""},
+		{"placeholder", "change-this-to-a-long-random-secret-value", false, "is still the placeholder value"},
+		{"short", "9f86d081884c7d65", false, "must be at least 32 characters"},
+		{"decimal", "12345678901234567890123456789012", false, "is too weak; use a long random value"},
+		{"repeated", strings.Repeat("ab", 20), false, "is too predictable; use a long random value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkSecret(tt.secret, tt.debug); got != tt.want {
+				t.Errorf("checkSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// restartRequired lists the values, or whole sections, that are only read
+// at startup. Changes to them are reported but take effect after a restart.
+var restartRequired = []string{
+	"server.host",
+	"server.port",
+	"database.driver",
+	"database.name",
+	"database.path",
+	"database.sqlite",
+	"database.dsn",
+	"database.host",
+	"database.port",
+	"database.user",
+	"database.password",
+	"database.sslmode",
+	"database.params",
+	"database.replicas",
+	"database.tables",
+	"database.atomic_requests",
+	"databases",
+	"session.name",
+	"session.secret",
+	"session.old_secrets",
+	"session.backend",
+	"session.path",
+	"session.gc_interval",
+	"auth.login_url",
+	"auth.logout_url",
+	"reload_interval",
+}
+
+// Watcher polls the files a configuration was loaded from and, when they
+// change, reloads and validates it and notifies subscribers
+type Watcher struct {
+	interval time.Duration
+
+	mu          sync.Mutex
+	current     *Config
+	modTimes    map[string]time.Time
+	subscribers []func(*Config)
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// NewWatcher creates a watcher for a configuration returned by LoadConfig
+// or LoadWithOptions. Call Start to begin polling.
+func NewWatcher(cfg *Config, interval time.Duration) (*Watcher, error) {
+	if cfg.options.Path == "" {
+		return nil, errors.New("config was not loaded from a file")
+	}
+
+	return &Watcher{
+		interval: interval,
+		current:  cfg,
+		modTimes: modTimes(cfg.files),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Subscribe registers fn to receive every successfully reloaded config
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Current returns the latest valid configuration
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current
+}
+
+// Start begins polling in the background
+func (w *Watcher) Start() {
+	w.startOnce.Do(func() {
+		go w.poll()
+	})
+}
+
+// Close stops polling. It is safe to call more than once.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+	w.startOnce.Do(func() {
+		close(w.done)
+	})
+	<-w.done
+	return nil
+}
+
+// Reload loads and validates the configuration again and publishes it to
+// subscribers. It returns the changed values that require a restart. On
+// error the current configuration is kept.
+func (w *Watcher) Reload() ([]string, error) {
+	w.mu.Lock()
+
+	next, err := LoadWithOptions(w.current.options)
+	if err != nil {
+		w.mu.Unlock()
+		return nil, err
+	}
+
+	previous := w.current.Values()
+	current := next.Values()
+	restart := make([]string, 0)
+	for path := range union(previous, current) {
+		if requiresRestart(path) && previous[path] != current[path] {
+			restart = append(restart, path)
+		}
+	}
+	sort.Strings(restart)
+
+	w.current = next
+	w.modTimes = modTimes(next.files)
+	subscribers := append([]func(*Config){}, w.subscribers...)
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(next)
+	}
+
+	return restart, nil
+}
+
+// requiresRestart reports whether path is in restartRequired or in one of
+// its sections
+func requiresRestart(path string) bool {
+	for _, p := range restartRequired {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// union returns the keys of both maps
+func union(a, b map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(a))
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+// poll checks the watched files every interval until Close is called
+func (w *Watcher) poll() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !w.changed() {
+				continue
+			}
+			restart, err := w.Reload()
+			if err != nil {
+				log.Printf("Config reload failed, keeping current configuration: %v", err)
+				continue
+			}
+			log.Printf("Configuration reloaded")
+			for _, path := range restart {
+				log.Printf("Config %s changed; restart required for it to take effect", path)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// changed reports whether any watched file was modified, created or removed
+func (w *Watcher) changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := false
+	for path, modTime := range modTimes(w.current.files) {
+		if !modTime.Equal(w.modTimes[path]) {
+			// Remember failed reloads so they aren't retried every tick
+			w.modTimes[path] = modTime
+			changed = true
+		}
+	}
+	return changed
+}
+
+// modTimes stats each file; missing files get the zero time
+func modTimes(files []string) map[string]time.Time {
+	times := make(map[string]time.Time, len(files))
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		} else {
+			times[path] = time.Time{}
+		}
+	}
+	return times
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// errRollback rolls back a request transaction without reporting an error
+var errRollback = errors.New("rollback")
+
+type txKey struct{}
+
+// txState is the open transaction carried by a context
+type txState struct {
+	tx *gorm.DB
+
+	mu    sync.Mutex
+	hooks []func()
+}
+
+// txFromContext returns the transaction carried by ctx, or nil
+func txFromContext(ctx context.Context) *txState {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state
+}
+
+// Atomic runs fn in a transaction on the default database of ctx, which is
+// committed if fn returns nil and rolled back if it returns an error or
+// panics. Called again with a context from inside the transaction, such as
+// tx.Statement.Context or the request context of an atomic request, it
+// uses a savepoint, so only the inner block is rolled back on error.
+func Atomic(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if state := txFromContext(ctx); state != nil {
+		state.mu.Lock()
+		mark := len(state.hooks)
+		state.mu.Unlock()
+
+		err := state.tx.WithContext(ctx).Transaction(fn)
+		if err != nil {
+			// Forget the hooks registered inside the rolled back savepoint
+			state.mu.Lock()
+			state.hooks = state.hooks[:mark]
+			state.mu.Unlock()
+		}
+		return err
+	}
+
+	db, err := Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	state := &txState{}
+	txCtx := context.WithValue(ctx, txKey{}, state)
+	err = db.WithContext(txCtx).Transaction(func(tx *gorm.DB) error {
+		state.tx = tx
+		return fn(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The transaction is committed; run its hooks in registration order
+	for _, hook := range state.hooks {
+		hook()
+	}
+	return nil
+}
+
+// OnCommit runs fn once the transaction carried by ctx commits, e.g. to
+// send an email only if the data it refers to was saved. Outside a
+// transaction fn runs right away. Hooks of rolled back transactions and
+// savepoints are discarded.
+func OnCommit(ctx context.Context, fn func()) {
+	state := txFromContext(ctx)
+	if state == nil {
+		fn()
+		return
+	}
+
+	state.mu.Lock()
+	state.hooks = append(state.hooks, fn)
+	state.mu.Unlock()
+}
+
+// AtomicRequests runs each request with an unsafe method, such as POST, in
+// a transaction. It is committed when the handler responds with a 2xx or
+// 3xx status and rolled back otherwise, or if the handler panics. Handlers
+// use the transaction through Conn(r.Context()). The response is buffered
+// until the transaction ends, so a failed commit is reported as a 500.
+func AtomicRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedWriter{header: w.Header(), status: http.StatusOK}
+		err := Atomic(r.Context(), func(tx *gorm.DB) error {
+			next.ServeHTTP(buf, r.WithContext(tx.Statement.Context))
+			if buf.status >= http.StatusBadRequest {
+				return errRollback
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errRollback) {
+			log.Printf("Error committing transaction for %s %s: %v", r.Method, r.URL.Path, err)
+			for key := range w.Header() {
+				w.Header().Del(key)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// bufferedWriter holds a response until the request transaction ends.
+// Headers go straight to the underlying writer's header map.
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.status = status
+	bw.wroteHeader = true
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	return bw.body.Write(b)
+}
@@ -1,93 +1,318 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"sync"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"going/internal/config"
+	"going/internal/signals"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 var (
-	db     *gorm.DB
-	dbOnce sync.Once
-	dbErr  error
+	// current is the most recently opened DB, returned by GetDB
+	current atomic.Pointer[DB]
 
 	// models to be registered
 	models = make([]interface{}, 0)
 
 	// ErrNotConnected is returned when the database is not connected
 	ErrNotConnected = errors.New("database not connected")
+	// ErrUnknownDatabase is returned by Get for names missing from the config
+	ErrUnknownDatabase = errors.New("unknown database")
 )
 
-// InitDB initializes the database connection
-func InitDB(cfg *config.Config) (*sql.DB, error) {
-	dbOnce.Do(func() {
-		switch cfg.Database.Driver {
-		case "sqlite3":
-			initSQLite(cfg)
-		default:
-			dbErr = fmt.Errorf("unsupported database driver: %s", cfg.Database.Driver)
+// DB holds the open connections of an application: the default database
+// and the named ones from the databases section
+type DB struct {
+	conns map[string]*gorm.DB
+	// tableRoutes maps tables to the named database they are routed to
+	tableRoutes map[string]string
+	// logger is shared by every connection, kept to apply config reloads
+	logger *queryLogger
+}
+
+// Open connects to the default database and any named ones, and
+// auto-migrates registered models if the config opts in. Each call returns
+// independent connections.
+func Open(cfg *config.Config) (*DB, error) {
+	d := &DB{
+		tableRoutes: make(map[string]string),
+		logger:      newQueryLogger(cfg),
+	}
+
+	conns, err := d.openAll(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d.conns = conns
+
+	for name, named := range cfg.Databases {
+		for _, table := range named.Tables {
+			d.tableRoutes[table] = name
+		}
+	}
+
+	// Auto-migrate registered models when enabled for development
+	if err := d.runMigrations(cfg); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	current.Store(d)
+	return d, nil
+}
+
+// openAll connects to every configured database, then routes reads to
+// replicas and the tables of named databases to their connection
+func (d *DB) openAll(cfg *config.Config) (map[string]*gorm.DB, error) {
+	configs := map[string]config.DatabaseConfig{config.DefaultDatabase: cfg.Database}
+	for name, named := range cfg.Databases {
+		configs[name] = *named
+	}
+
+	conns := make(map[string]*gorm.DB, len(configs))
+	for name, dbCfg := range configs {
+		conn, err := d.open(dbCfg)
+		if err != nil {
+			closeAll(conns)
+			if name == config.DefaultDatabase {
+				return nil, err
+			}
+			return nil, fmt.Errorf("database %s: %w", name, err)
 		}
-	})
+		conns[name] = conn
+	}
+
+	if err := route(conns, configs); err != nil {
+		closeAll(conns)
+		return nil, fmt.Errorf("failed to configure database routing: %w", err)
+	}
+
+	return conns, nil
+}
+
+// open connects to a single database and checks the connection
+func (d *DB) open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	dialect, err := dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	if dbErr != nil {
-		return nil, dbErr
+	conn, err := gorm.Open(dialect, &gorm.Config{Logger: d.logger})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	sqlDB, err := db.DB()
+	sqlDB, err := conn.DB()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
 	}
 
+	configurePool(sqlDB, cfg)
+
+	if err := registerSignals(conn); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
 	// Test the connection
 	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Run migrations
-	if err := runMigrations(); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	return conn, nil
+}
+
+// route registers a dbresolver on each connection that has replicas, so
+// SELECTs go to a replica and writes to the primary. The default connection
+// also sends queries on the tables of named databases to them.
+func route(conns map[string]*gorm.DB, configs map[string]config.DatabaseConfig) error {
+	// Reuse the open connections rather than letting dbresolver open more
+	dialectors := func(names []string) ([]gorm.Dialector, error) {
+		list := make([]gorm.Dialector, 0, len(names))
+		for _, name := range names {
+			sqlDB, err := conns[name].DB()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, connDialector(configs[name].Driver, sqlDB))
+		}
+		return list, nil
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		resolver := &dbresolver.DBResolver{}
+		registered := false
+
+		replicas, err := dialectors(configs[name].Replicas)
+		if err != nil {
+			return err
+		}
+		if len(replicas) > 0 {
+			resolver.Register(dbresolver.Config{Replicas: replicas})
+			registered = true
+		}
+
+		if name == config.DefaultDatabase {
+			for _, other := range names {
+				named := configs[other]
+				if other == config.DefaultDatabase || len(named.Tables) == 0 {
+					continue
+				}
+
+				sources, err := dialectors([]string{other})
+				if err != nil {
+					return err
+				}
+				replicas, err := dialectors(named.Replicas)
+				if err != nil {
+					return err
+				}
+
+				tables := make([]interface{}, len(named.Tables))
+				for i, table := range named.Tables {
+					tables[i] = table
+				}
+				resolver.Register(dbresolver.Config{Sources: sources, Replicas: replicas}, tables...)
+				registered = true
+			}
+		}
+
+		if registered {
+			if err := conns[name].Use(resolver); err != nil {
+				return fmt.Errorf("database %s: %w", name, err)
+			}
+		}
 	}
 
-	return sqlDB, nil
+	return nil
+}
+
+// configurePool applies the connection pool settings
+func configurePool(sqlDB *sql.DB, cfg config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+}
+
+// Default returns the default database connection
+func (d *DB) Default() *gorm.DB {
+	return d.conns[config.DefaultDatabase]
 }
 
-// initSQLite initializes a SQLite database
-func initSQLite(cfg *config.Config) {
-	// Ensure the database directory exists
-	if err := os.MkdirAll(cfg.Database.Path, 0755); err != nil {
-		dbErr = fmt.Errorf("failed to create database directory: %w", err)
-		return
+// Get returns the database with the given name from the databases section,
+// or the default database for "default"
+func (d *DB) Get(name string) (*gorm.DB, error) {
+	conn, ok := d.conns[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDatabase, name)
 	}
+	return conn, nil
+}
 
-	dbPath := filepath.Join(cfg.Database.Path, cfg.Database.Name)
+// Reload applies the logging and pool settings of a reloaded configuration
+func (d *DB) Reload(cfg *config.Config) {
+	d.logger.Reload(cfg)
 
-	// Configure GORM logger
-	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	for name, conn := range d.conns {
+		dbCfg := cfg.Database
+		if name != config.DefaultDatabase {
+			named, ok := cfg.Databases[name]
+			if !ok {
+				continue
+			}
+			dbCfg = *named
+		}
+		if sqlDB, err := conn.DB(); err == nil {
+			configurePool(sqlDB, dbCfg)
+		}
 	}
+}
+
+// Close closes every connection. GetDB stops returning this database.
+func (d *DB) Close() error {
+	current.CompareAndSwap(d, nil)
+	return closeAll(d.conns)
+}
 
-	// Connect to the database
-	db, dbErr = gorm.Open(sqlite.Open(dbPath), gormConfig)
-	if dbErr != nil {
-		dbErr = fmt.Errorf("failed to connect to database: %w", dbErr)
+// closeAll closes the given connections, collecting errors
+func closeAll(conns map[string]*gorm.DB) error {
+	var errs []error
+	for name, conn := range conns {
+		sqlDB, err := conn.DB()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get sql.DB for %s: %w", name, err))
+			continue
+		}
+		if err := sqlDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database %s: %w", name, err))
+		}
 	}
+	return errors.Join(errs...)
 }
 
-// GetDB returns the database instance
+// GetDB returns the default connection of the most recently opened
+// database. It is kept for compatibility; prefer the application's DB or
+// Conn, which stay correct when several applications share a process.
 func GetDB() (*gorm.DB, error) {
-	if db == nil {
+	d := current.Load()
+	if d == nil {
 		return nil, ErrNotConnected
 	}
-	return db, nil
+	return d.Default(), nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying d, so code handling a request uses
+// the application's database
+func NewContext(ctx context.Context, d *DB) context.Context {
+	return context.WithValue(ctx, contextKey{}, d)
+}
+
+// FromContext returns the database carried by ctx, falling back to the
+// most recently opened one
+func FromContext(ctx context.Context) (*DB, error) {
+	if d, ok := ctx.Value(contextKey{}).(*DB); ok {
+		return d, nil
+	}
+	if d := current.Load(); d != nil {
+		return d, nil
+	}
+	return nil, ErrNotConnected
+}
+
+// Conn returns the default connection of the database carried by ctx,
+// bound to ctx so queries are logged and counted with the request. Inside
+// Atomic it returns the open transaction.
+func Conn(ctx context.Context) (*gorm.DB, error) {
+	if state := txFromContext(ctx); state != nil && state.tx != nil {
+		return state.tx.WithContext(ctx), nil
+	}
+
+	d, err := FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.Default().WithContext(ctx), nil
 }
 
 // RegisterModels registers models for auto-migration
@@ -95,32 +320,86 @@ func RegisterModels(modelList ...interface{}) {
 	models = append(models, modelList...)
 }
 
-// runMigrations runs database migrations
-func runMigrations() error {
-	if db == nil {
-		return ErrNotConnected
+// Models returns the models registered for migration
+func Models() []interface{} {
+	list := make([]interface{}, len(models))
+	copy(list, models)
+	return list
+}
+
+// ModelLabel returns the app label (the model's package name) and the
+// lowercased model name, e.g. "blog" and "post"
+func ModelLabel(model interface{}) (string, string) {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
+	return path.Base(t.PkgPath()), strings.ToLower(t.Name())
+}
 
-	// Auto migrate all registered models
-	if len(models) > 0 {
-		if err := db.AutoMigrate(models...); err != nil {
-			return fmt.Errorf("failed to migrate models: %w", err)
-		}
+// route returns the name of the database the model's table lives in
+func (d *DB) route(model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: d.Default()}
+	if err := stmt.Parse(model); err != nil {
+		return "", fmt.Errorf("failed to parse model %T: %w", model, err)
 	}
 
-	return nil
+	if name, ok := d.tableRoutes[stmt.Table]; ok {
+		return name, nil
+	}
+	return config.DefaultDatabase, nil
+}
+
+// For returns the connection of the database the model's table lives in
+func (d *DB) For(model interface{}) (*gorm.DB, error) {
+	name, err := d.route(model)
+	if err != nil {
+		return nil, err
+	}
+	return d.Get(name)
+}
+
+// ModelsFor returns the registered models whose tables live in the named
+// database, according to the tables routed to named databases
+func (d *DB) ModelsFor(name string) ([]interface{}, error) {
+	list := make([]interface{}, 0)
+	for _, model := range models {
+		route, err := d.route(model)
+		if err != nil {
+			return nil, err
+		}
+		if route == name {
+			list = append(list, model)
+		}
+	}
+	return list, nil
 }
 
-// Close closes the database connection
-func Close() error {
-	if db == nil {
+// runMigrations auto-migrates registered models if the config opts in.
+// Versioned migrations are applied separately with the migrate command.
+func (d *DB) runMigrations(cfg *config.Config) error {
+	if !cfg.Database.AutoMigrate {
 		return nil
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get sql.DB: %w", err)
+	// Auto migrate each registered model on the database it is routed to
+	for name, conn := range d.conns {
+		list, err := d.ModelsFor(name)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			continue
+		}
+		if err := conn.AutoMigrate(list...); err != nil {
+			return fmt.Errorf("failed to migrate models: %w", err)
+		}
+
+		err = signals.PostMigrate.Send(context.Background(), &signals.Event{DB: conn, Database: name, Models: list})
+		if err != nil {
+			return err
+		}
 	}
 
-	return sqlDB.Close()
+	return nil
 }
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"going/internal/config"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// routedEvent lives in a named database in the routing tests
+type routedEvent struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func (routedEvent) TableName() string {
+	return "routed_events"
+}
+
+// openRouted opens a default SQLite database and the given named ones, each
+// in its own file with a routed_events table
+func openRouted(t *testing.T, configure func(cfg *config.Config), names ...string) *DB {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = dir
+	cfg.Database.Name = "default.db"
+	cfg.Database.LogLevel = "silent"
+	cfg.Databases = make(map[string]*config.DatabaseConfig)
+	for _, name := range names {
+		named := cfg.Database
+		named.Name = name + ".db"
+		cfg.Databases[name] = &named
+	}
+	configure(cfg)
+
+	d, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	for _, name := range append([]string{config.DefaultDatabase}, names...) {
+		conn, err := d.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Raw statements aren't routed, so each file gets its own table
+		if err := conn.Exec("CREATE TABLE routed_events (id integer PRIMARY KEY, name text)").Error; err != nil {
+			t.Fatalf("failed to create table in %s: %v", name, err)
+		}
+	}
+	return d
+}
+
+// eventNames returns the names of the events stored in a database file,
+// read on its own connection without routing
+func eventNames(t *testing.T, d *DB, name string) []string {
+	t.Helper()
+
+	conn, err := d.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := sqlDB.Query("SELECT name FROM routed_events ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestNamedDatabaseRouting(t *testing.T) {
+	d := openRouted(t, func(cfg *config.Config) {
+		cfg.Databases["events"].Tables = []string{"routed_events"}
+	}, "events")
+
+	conn, err := d.For(&routedEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named, _ := d.Get("events"); conn != named {
+		t.Error("For did not return the events database")
+	}
+
+	// The default connection and Conn route the table's writes and reads
+	ctx := NewContext(context.Background(), d)
+	db, err := Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&routedEvent{Name: "signup"}).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	if got := eventNames(t, d, "events"); len(got) != 1 || got[0] != "signup" {
+		t.Errorf("events database has %v, want [signup]", got)
+	}
+	if got := eventNames(t, d, config.DefaultDatabase); len(got) != 0 {
+		t.Errorf("default database has %v, want none", got)
+	}
+
+	var found []routedEvent
+	if err := d.Default().Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "signup" {
+		t.Errorf("read %v through the default connection, want the signup event", found)
+	}
+}
+
+func TestReplicaRouting(t *testing.T) {
+	d := openRouted(t, func(cfg *config.Config) {
+		cfg.Database.Replicas = []string{"replica"}
+	}, "replica")
+
+	// Writes go to the primary
+	if err := d.Default().Create(&routedEvent{Name: "primary"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := eventNames(t, d, config.DefaultDatabase); len(got) != 1 || got[0] != "primary" {
+		t.Errorf("primary has %v, want [primary]", got)
+	}
+	if got := eventNames(t, d, "replica"); len(got) != 0 {
+		t.Errorf("replica has %v, want none", got)
+	}
+
+	// Nothing replicates between the files, so reads show where they went
+	replica, err := d.Get("replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Create(&routedEvent{Name: "replica"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var found []routedEvent
+	if err := d.Default().Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "replica" {
+		t.Errorf("read %v, want the replica's row", found)
+	}
+
+	found = nil
+	if err := d.Default().Clauses(dbresolver.Write).Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "primary" {
+		t.Errorf("read %v with dbresolver.Write, want the primary's row", found)
+	}
+}
+
+func TestConnFallsBackToDefault(t *testing.T) {
+	d := openRouted(t, func(cfg *config.Config) {}, "other")
+
+	// Models without a route use the default database
+	conn, err := d.For(&routedEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != d.Default() {
+		t.Error("For did not return the default database")
+	}
+
+	// Without a database in the context, Conn uses the last one opened
+	db, err := Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	if err := db.Create(&routedEvent{Name: "fallback"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := eventNames(t, d, config.DefaultDatabase); len(got) != 1 || got[0] != "fallback" {
+		t.Errorf("default database has %v, want [fallback]", got)
+	}
+	if got := eventNames(t, d, "other"); len(got) != 0 {
+		t.Errorf("other database has %v, want none", got)
+	}
+
+	// Inside Atomic, Conn returns the transaction on the default database
+	err = Atomic(NewContext(context.Background(), d), func(tx *gorm.DB) error {
+		inner, err := Conn(tx.Statement.Context)
+		if err != nil {
+			return err
+		}
+		return inner.Create(&routedEvent{Name: "atomic"}).Error
+	})
+	if err != nil {
+		t.Fatalf("Atomic: %v", err)
+	}
+	if got := eventNames(t, d, config.DefaultDatabase); len(got) != 2 {
+		t.Errorf("default database has %v, want two events", got)
+	}
+
+	if _, err := d.Get("missing"); err == nil {
+		t.Error("expected an error for an unknown database")
+	}
+}
+
+func TestConnWithoutDatabase(t *testing.T) {
+	d := openRouted(t, func(cfg *config.Config) {})
+	d.Close()
+
+	if _, err := Conn(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+// loadConfig loads a YAML config the way the CLI does
+func loadConfig(t *testing.T, content string, overrides map[string]string) (*config.Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return config.LoadWithOptions(config.Options{Path: path, Overrides: overrides})
+}
+
+func TestNamedDatabasesMustBeDistinct(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadConfig(t, `
+debug: true
+database:
+  path: `+dir+`
+  name: going.db
+  replicas: [replica]
+databases:
+  replica: {}
+  analytics:
+    tables: [routed_events]
+  archive:
+    name: archive.db
+  copy:
+    name: archive.db
+  scratch:
+    name: ":memory:"
+  scratch2:
+    name: ":memory:"
+`, nil)
+
+	var verr config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	var paths []string
+	for _, e := range verr {
+		paths = append(paths, e.Path)
+	}
+	sort.Strings(paths)
+	want := []string{"databases.analytics", "databases.copy", "databases.replica"}
+	if len(paths) != len(want) || paths[0] != want[0] || paths[1] != want[1] || paths[2] != want[2] {
+		t.Errorf("errors for %v, want %v: %v", paths, want, err)
+	}
+}
+
+func TestNamedDatabasesInheritOverrides(t *testing.T) {
+	t.Setenv("GOING_DATABASE_HOST", "db.prod")
+	cfg, err := loadConfig(t, `
+debug: true
+database:
+  driver: postgres
+  host: db.local
+  name: going
+  user: going
+  password: from-file
+  replicas: [replica]
+databases:
+  replica:
+    host: replica.local
+  analytics:
+    name: analytics
+`, map[string]string{
+		"database.password":        "from-flag",
+		"databases.analytics.port": "6543",
+	})
+	if err != nil {
+		t.Fatalf("LoadWithOptions: %v", err)
+	}
+
+	analytics, replica := cfg.Databases["analytics"], cfg.Databases["replica"]
+	if cfg.Database.Host != "db.prod" || analytics.Host != "db.prod" {
+		t.Errorf("hosts %q and %q, want the env value for both", cfg.Database.Host, analytics.Host)
+	}
+	if replica.Host != "replica.local" {
+		t.Errorf("replica host %q; its own value must win over the env value", replica.Host)
+	}
+	if analytics.Password != "from-flag" || replica.Password != "from-flag" {
+		t.Errorf("passwords %q and %q, want the flag value", analytics.Password, replica.Password)
+	}
+	if analytics.Port != "6543" || cfg.Database.Port == "6543" {
+		t.Errorf("override of a named database applied to ports %q and %q", cfg.Database.Port, analytics.Port)
+	}
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"going/internal/config"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// defaultPorts are used when database.port is empty
+var defaultPorts = map[string]string{
+	"postgres": "5432",
+	"mysql":    "3306",
+}
+
+// memoryName as a SQLite database name opens a private in-memory database
+const memoryName = ":memory:"
+
+// memoryDBs numbers in-memory databases
+var memoryDBs atomic.Int64
+
+// dialector returns the GORM dialector for the configured driver. A raw
+// database.dsn is passed to the driver as is.
+func dialector(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case "sqlite3":
+		if cfg.DSN != "" {
+			return sqlite.Open(cfg.DSN), nil
+		}
+
+		if cfg.Name == memoryName {
+			// Give each in-memory database a unique name, shared by the
+			// connections of its pool
+			name := fmt.Sprintf("file:memdb%d?mode=memory&cache=shared", memoryDBs.Add(1))
+			return sqlite.Open(sqliteDSN(name, cfg.SQLite)), nil
+		}
+
+		// Ensure the database directory exists
+		if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		return sqlite.Open(sqliteDSN(filepath.Join(cfg.Path, cfg.Name), cfg.SQLite)), nil
+	case "postgres":
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = postgresDSN(cfg)
+		}
+		return postgres.Open(dsn), nil
+	case "mysql":
+		dsn := cfg.DSN
+		if dsn == "" {
+			var err error
+			if dsn, err = mysqlDSN(cfg); err != nil {
+				return nil, err
+			}
+		}
+		return mysql.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+}
+
+// connDialector returns a dialector for the driver that uses an already
+// open connection
+func connDialector(driver string, conn *sql.DB) gorm.Dialector {
+	switch driver {
+	case "postgres":
+		return postgres.New(postgres.Config{Conn: conn})
+	case "mysql":
+		return mysql.New(mysql.Config{Conn: conn})
+	default:
+		return &sqlite.Dialector{Conn: conn}
+	}
+}
+
+// sqliteDSN appends the configured pragmas to the database path. The
+// driver applies them each time it opens a connection.
+func sqliteDSN(path string, cfg config.SQLiteConfig) string {
+	params := url.Values{}
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", strings.ToUpper(cfg.JournalMode))
+	}
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.Itoa(cfg.BusyTimeout))
+	}
+	params.Set("_foreign_keys", strconv.FormatBool(cfg.ForeignKeys))
+	if cfg.Synchronous != "" {
+		params.Set("_synchronous", strings.ToUpper(cfg.Synchronous))
+	}
+	if cfg.TxLock != "" {
+		params.Set("_txlock", strings.ToLower(cfg.TxLock))
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + params.Encode()
+}
+
+// postgresDSN builds a postgres:// URL from the connection fields
+func postgresDSN(cfg config.DatabaseConfig) string {
+	params := url.Values{}
+	if cfg.SSLMode != "" {
+		params.Set("sslmode", cfg.SSLMode)
+	}
+	for key, value := range cfg.Params {
+		params.Set(key, value)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		Host:     hostPort(cfg),
+		Path:     "/" + cfg.Name,
+		RawQuery: params.Encode(),
+	}
+	if cfg.User != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Password)
+	}
+	return u.String()
+}
+
+// mysqlDSN builds a go-sql-driver DSN from the connection fields. Times
+// are parsed into time.Time and multiple statements are allowed so that
+// migration files can hold several statements; params override both.
+func mysqlDSN(cfg config.DatabaseConfig) (string, error) {
+	c := gomysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Password
+	c.Net = "tcp"
+	c.Addr = hostPort(cfg)
+	c.DBName = cfg.Name
+	c.ParseTime = true
+	c.Loc = time.Local
+	c.MultiStatements = true
+	dsn := c.FormatDSN()
+
+	if len(cfg.Params) == 0 {
+		return dsn, nil
+	}
+
+	// Let the driver parse the params so known options such as charset or
+	// tls are validated; later values win
+	keys := make([]string, 0, len(cfg.Params))
+	for key := range cfg.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, key+"="+url.QueryEscape(cfg.Params[key]))
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	parsed, err := gomysql.ParseDSN(dsn + separator + strings.Join(params, "&"))
+	if err != nil {
+		return "", fmt.Errorf("invalid database.params: %w", err)
+	}
+	return parsed.FormatDSN(), nil
+}
+
+// hostPort joins the host and port, defaulting to localhost and the
+// driver's standard port
+func hostPort(cfg config.DatabaseConfig) string {
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+	port := cfg.Port
+	if port == "" {
+		port = defaultPorts[cfg.Driver]
+	}
+	return net.JoinHostPort(host, port)
+}
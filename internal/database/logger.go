@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"going/internal/config"
+	"going/internal/middleware"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// logLevels maps database.log_level to GORM log levels
+var logLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// queryLogger is a GORM logger that writes through the standard logger,
+// prefixed with the request ID when the query's context carries one. Its
+// settings can be changed at runtime with Reload.
+type queryLogger struct {
+	level         atomic.Int32
+	slowThreshold atomic.Int64 // time.Duration
+	redact        atomic.Bool
+}
+
+// newQueryLogger creates a logger configured from cfg
+func newQueryLogger(cfg *config.Config) *queryLogger {
+	l := &queryLogger{}
+	l.Reload(cfg)
+	return l
+}
+
+// Reload applies the log level, slow query threshold and redaction settings
+func (l *queryLogger) Reload(cfg *config.Config) {
+	level, ok := logLevels[cfg.Database.LogLevel]
+	if !ok {
+		level = logger.Warn
+	}
+	l.level.Store(int32(level))
+	l.slowThreshold.Store(int64(time.Duration(cfg.Database.SlowQueryThreshold) * time.Millisecond))
+	l.redact.Store(cfg.Database.RedactParams)
+}
+
+// LogMode returns a logger fixed at the given level
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := &queryLogger{}
+	copied.level.Store(int32(level))
+	copied.slowThreshold.Store(l.slowThreshold.Load())
+	copied.redact.Store(l.redact.Load())
+	return copied
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.logf(ctx, logger.Info, msg, args...)
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.logf(ctx, logger.Warn, msg, args...)
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.logf(ctx, logger.Error, msg, args...)
+}
+
+// Trace logs a query according to the level: errors, slow queries, or
+// every query at info level. It also feeds the request's query counter.
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	countQuery(ctx)
+
+	level := logger.LogLevel(l.level.Load())
+	if level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := time.Duration(l.slowThreshold.Load())
+
+	switch {
+	case err != nil && level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.logf(ctx, logger.Error, "query error: %v [%s] [rows:%d] %s", err, elapsed, rows, sql)
+	case slow > 0 && elapsed > slow && level >= logger.Warn:
+		sql, rows := fc()
+		l.logf(ctx, logger.Warn, "slow query >= %s [%s] [rows:%d] %s", slow, elapsed, rows, sql)
+	case level >= logger.Info:
+		sql, rows := fc()
+		l.logf(ctx, logger.Info, "[%s] [rows:%d] %s", elapsed, rows, sql)
+	}
+}
+
+// ParamsFilter hides query parameters when redaction is enabled. GORM
+// bypasses it for Raw(...).Scan, which logs through its own recorder.
+func (l *queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.redact.Load() {
+		return sql, nil
+	}
+	return sql, params
+}
+
+// logf writes a message if the logger's level allows it
+func (l *queryLogger) logf(ctx context.Context, level logger.LogLevel, format string, args ...interface{}) {
+	if logger.LogLevel(l.level.Load()) < level {
+		return
+	}
+
+	prefix := "db: "
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		prefix = fmt.Sprintf("db [%s]: ", id)
+	}
+	log.Printf(prefix+format, args...)
+}
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a context that counts the queries run with it,
+// e.g. to spot N+1 query patterns in a request
+func WithQueryCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryCounterKey{}, new(atomic.Int64))
+}
+
+// QueryCount returns the number of queries run with a context created by
+// WithQueryCounter
+func QueryCount(ctx context.Context) int64 {
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+func countQuery(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
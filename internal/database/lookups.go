@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// likeEscape escapes LIKE wildcards; it is portable, unlike a backslash,
+// which MySQL treats as an escape in string literals
+const likeEscape = "!"
+
+// lookups translates a lookup and its value into a parameterized
+// condition on a column
+var lookups = map[string]func(col clause.Column, value interface{}) (clause.Expression, error){
+	"exact": func(col clause.Column, value interface{}) (clause.Expression, error) {
+		if value == nil {
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{col}}, nil
+		}
+		return clause.Expr{SQL: "? = ?", Vars: []interface{}{col, value}}, nil
+	},
+	"iexact": func(col clause.Column, value interface{}) (clause.Expression, error) {
+		return clause.Expr{SQL: "LOWER(?) = LOWER(?)", Vars: []interface{}{col, value}}, nil
+	},
+	"in": func(col clause.Column, value interface{}) (clause.Expression, error) {
+		v := reflect.ValueOf(value)
+		if value == nil || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) {
+			return nil, fmt.Errorf("in lookup expects a slice, got %T", value)
+		}
+		if v.Len() == 0 {
+			// Matches nothing, and its negation everything
+			return clause.Expr{SQL: "1 = 0"}, nil
+		}
+		return clause.Expr{SQL: "? IN ?", Vars: []interface{}{col, value}}, nil
+	},
+	"gt":  comparison(">"),
+	"gte": comparison(">="),
+	"lt":  comparison("<"),
+	"lte": comparison("<="),
+	"range": func(col clause.Column, value interface{}) (clause.Expression, error) {
+		v := reflect.ValueOf(value)
+		if value == nil || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() != 2 {
+			return nil, fmt.Errorf("range lookup expects two values, got %v", value)
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{col, v.Index(0).Interface(), v.Index(1).Interface()}}, nil
+	},
+	"isnull": func(col clause.Column, value interface{}) (clause.Expression, error) {
+		isNull, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("isnull lookup expects a bool, got %T", value)
+		}
+		if isNull {
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{col}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{col}}, nil
+	},
+	"contains":    like("%", "%", false),
+	"icontains":   like("%", "%", true),
+	"startswith":  like("", "%", false),
+	"istartswith": like("", "%", true),
+	"endswith":    like("%", "", false),
+	"iendswith":   like("%", "", true),
+}
+
+// comparison returns a lookup comparing a column with op
+func comparison(op string) func(clause.Column, interface{}) (clause.Expression, error) {
+	return func(col clause.Column, value interface{}) (clause.Expression, error) {
+		return clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{col, value}}, nil
+	}
+}
+
+// like returns a lookup matching a column against a LIKE pattern of the
+// escaped value between prefix and suffix. Whether plain LIKE is case
+// sensitive depends on the database; SQLite ignores case for ASCII.
+func like(prefix, suffix string, fold bool) func(clause.Column, interface{}) (clause.Expression, error) {
+	return func(col clause.Column, value interface{}) (clause.Expression, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %T", value)
+		}
+		pattern := prefix + escapeLike(s) + suffix
+		if fold {
+			return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?) ESCAPE '" + likeEscape + "'", Vars: []interface{}{col, pattern}}, nil
+		}
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '" + likeEscape + "'", Vars: []interface{}{col, pattern}}, nil
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(s)
+}
+
+// lookup is a condition such as name__icontains with its value
+type lookup struct {
+	key   string
+	value interface{}
+}
+
+// expression resolves the lookup's field against s and translates it
+func (l lookup) expression(s *schema.Schema) (clause.Expression, error) {
+	name, kind, found := strings.Cut(l.key, "__")
+	if !found {
+		kind = "exact"
+	}
+
+	translate, ok := lookups[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported lookup %q in %s", kind, l.key)
+	}
+	field := s.LookUpField(name)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("unknown field %q in %s", name, l.key)
+	}
+
+	expr, err := translate(clause.Column{Table: clause.CurrentTable, Name: field.DBName}, l.value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.key, err)
+	}
+	return expr, nil
+}
+
+// pairs turns alternating keys and values into lookups
+func pairs(args []interface{}) ([]lookup, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("expected key and value pairs, got %d arguments", len(args))
+	}
+
+	list := make([]lookup, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a lookup string, got %T", args[i])
+		}
+		list = append(list, lookup{key: key, value: args[i+1]})
+	}
+	return list, nil
+}
@@ -0,0 +1,401 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrMultipleObjects is returned by Get when more than one row matches
+var ErrMultipleObjects = errors.New("multiple objects returned")
+
+// Manager is the entry point for querying model T; see Objects. Apps can
+// embed it to add their own query methods.
+type Manager[T any] struct {
+	QuerySet[T]
+}
+
+// Objects returns the manager of model T, e.g.
+// Objects[Post]().Filter("title__icontains", "go").OrderBy("-id").All(ctx)
+func Objects[T any]() Manager[T] {
+	return Manager[T]{}
+}
+
+// QuerySet is a lazy, chainable query on model T. Each method returns a
+// new QuerySet, so one can be reused as the base of several queries. It
+// runs on the database carried by the context passed to the method that
+// executes it, inside the transaction if there is one.
+//
+// Conditions are lookups of a field, by Go or column name, and a value:
+// "name" or "name__exact", iexact, in, gt, gte, lt, lte, range, isnull,
+// contains, icontains, startswith, istartswith, endswith and iendswith.
+type QuerySet[T any] struct {
+	// filters are ANDed; each is negated if it comes from Exclude
+	filters []filter
+	order   []string
+	limit   int
+	offset  int
+	err     error
+}
+
+// filter is a group of lookups from one Filter or Exclude call
+type filter struct {
+	lookups []lookup
+	exclude bool
+}
+
+// Filter returns rows matching every lookup, given as key and value pairs:
+// Filter("name__startswith", "a", "age__gte", 18)
+func (qs QuerySet[T]) Filter(args ...interface{}) QuerySet[T] {
+	return qs.where(args, false)
+}
+
+// Exclude returns rows that don't match all the lookups together
+func (qs QuerySet[T]) Exclude(args ...interface{}) QuerySet[T] {
+	return qs.where(args, true)
+}
+
+func (qs QuerySet[T]) where(args []interface{}, exclude bool) QuerySet[T] {
+	list, err := pairs(args)
+	if err != nil {
+		qs.err = errors.Join(qs.err, err)
+		return qs
+	}
+	qs.filters = append(qs.filters[:len(qs.filters):len(qs.filters)], filter{lookups: list, exclude: exclude})
+	return qs
+}
+
+// OrderBy sorts by the given fields, descending if prefixed with "-",
+// replacing any previous ordering
+func (qs QuerySet[T]) OrderBy(fields ...string) QuerySet[T] {
+	qs.order = fields
+	return qs
+}
+
+// Limit returns at most n rows
+func (qs QuerySet[T]) Limit(n int) QuerySet[T] {
+	qs.limit = n
+	return qs
+}
+
+// Offset skips the first n rows
+func (qs QuerySet[T]) Offset(n int) QuerySet[T] {
+	qs.offset = n
+	return qs
+}
+
+// query builds the GORM query for the conditions and ordering
+func (qs QuerySet[T]) query(ctx context.Context) (*gorm.DB, *schema.Schema, error) {
+	if qs.err != nil {
+		return nil, nil, qs.err
+	}
+
+	conn, err := Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := qs.schema(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db := conn.Model(new(T))
+	for _, f := range qs.filters {
+		exprs := make([]clause.Expression, 0, len(f.lookups))
+		for _, l := range f.lookups {
+			expr, err := l.expression(s)
+			if err != nil {
+				return nil, nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		if len(exprs) == 0 {
+			continue
+		}
+
+		// clause.Not negates each expression, not their conjunction
+		if f.exclude {
+			db = db.Where(clause.Expr{SQL: "NOT (?)", Vars: []interface{}{clause.And(exprs...)}})
+		} else {
+			db = db.Where(clause.And(exprs...))
+		}
+	}
+
+	for _, name := range qs.order {
+		desc := strings.HasPrefix(name, "-")
+		field := s.LookUpField(strings.TrimPrefix(name, "-"))
+		if field == nil || field.DBName == "" {
+			return nil, nil, fmt.Errorf("unknown field %q in ordering", name)
+		}
+		db = db.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+			Desc:   desc,
+		})
+	}
+
+	return db, s, nil
+}
+
+// sliced applies the limit and offset
+func (qs QuerySet[T]) sliced(db *gorm.DB) *gorm.DB {
+	if qs.limit > 0 {
+		db = db.Limit(qs.limit)
+	}
+	if qs.offset > 0 {
+		db = db.Offset(qs.offset)
+	}
+	return db
+}
+
+// All returns the matching rows
+func (qs QuerySet[T]) All(ctx context.Context) ([]T, error) {
+	db, _, err := qs.query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]T, 0)
+	if err := qs.sliced(db).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns the single row matching the query and the lookups. It
+// returns gorm.ErrRecordNotFound if none match and ErrMultipleObjects if
+// several do.
+func (qs QuerySet[T]) Get(ctx context.Context, args ...interface{}) (*T, error) {
+	db, _, err := qs.Filter(args...).query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]T, 0, 2)
+	if err := db.Limit(2).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	switch len(list) {
+	case 0:
+		return nil, gorm.ErrRecordNotFound
+	case 1:
+		return &list[0], nil
+	default:
+		return nil, ErrMultipleObjects
+	}
+}
+
+// Count returns the number of matching rows
+func (qs QuerySet[T]) Count(ctx context.Context) (int64, error) {
+	db, _, err := qs.query(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if qs.limit > 0 || qs.offset > 0 {
+		// Count the slice, not every matching row
+		conn := db.Session(&gorm.Session{NewDB: true})
+		err = conn.Table("(?) AS sliced", qs.sliced(db).Select("1")).Count(&count).Error
+	} else {
+		err = db.Count(&count).Error
+	}
+	return count, err
+}
+
+// Exists reports whether any row matches
+func (qs QuerySet[T]) Exists(ctx context.Context) (bool, error) {
+	db, _, err := qs.query(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var found []int
+	if err := db.Offset(qs.offset).Select("1").Limit(1).Find(&found).Error; err != nil {
+		return false, err
+	}
+	return len(found) > 0, nil
+}
+
+// Values returns the given fields, or every column, of the matching rows
+// as maps keyed by column name
+func (qs QuerySet[T]) Values(ctx context.Context, fields ...string) ([]map[string]interface{}, error) {
+	db, s, err := qs.query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		columns := make([]string, len(fields))
+		for i, name := range fields {
+			field := s.LookUpField(name)
+			if field == nil || field.DBName == "" {
+				return nil, fmt.Errorf("unknown field %q", name)
+			}
+			columns[i] = field.DBName
+		}
+		db = db.Select(columns)
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	if err := qs.sliced(db).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Create saves a new row
+func (qs QuerySet[T]) Create(ctx context.Context, obj *T) error {
+	conn, err := Conn(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Create(obj).Error
+}
+
+// BulkCreate saves new rows with multi-row inserts of at most batchSize
+// rows, or a single insert if batchSize is 0
+func (qs QuerySet[T]) BulkCreate(ctx context.Context, objs []*T, batchSize int) error {
+	if len(objs) == 0 {
+		return nil
+	}
+
+	conn, err := Conn(ctx)
+	if err != nil {
+		return err
+	}
+	if batchSize > 0 {
+		return conn.CreateInBatches(objs, batchSize).Error
+	}
+	return conn.Create(objs).Error
+}
+
+// GetOrCreate returns the row matching the lookups, or creates it from the
+// exact lookups and defaults. It reports whether the row was created.
+func (qs QuerySet[T]) GetOrCreate(ctx context.Context, defaults map[string]interface{}, args ...interface{}) (*T, bool, error) {
+	obj, err := qs.Get(ctx, args...)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return obj, false, err
+	}
+
+	obj, err = qs.build(ctx, defaults, args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// A savepoint keeps an enclosing transaction usable if the insert fails
+	err = Atomic(ctx, func(tx *gorm.DB) error {
+		return tx.Create(obj).Error
+	})
+	if err != nil {
+		// Another request may have created the row in the meantime
+		if existing, getErr := qs.Get(ctx, args...); getErr == nil {
+			return existing, false, nil
+		}
+		return nil, false, err
+	}
+	return obj, true, nil
+}
+
+// UpdateOrCreate updates the row matching the lookups with defaults, or
+// creates it from the exact lookups and defaults. It reports whether the
+// row was created.
+func (qs QuerySet[T]) UpdateOrCreate(ctx context.Context, defaults map[string]interface{}, args ...interface{}) (*T, bool, error) {
+	var obj *T
+	created := false
+	err := Atomic(ctx, func(tx *gorm.DB) error {
+		txCtx := tx.Statement.Context
+
+		var err error
+		obj, err = qs.Get(txCtx, args...)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if obj, err = qs.build(txCtx, defaults, args); err != nil {
+				return err
+			}
+			created = true
+			return tx.Create(obj).Error
+		}
+		if err != nil || len(defaults) == 0 {
+			return err
+		}
+
+		s, err := qs.schema(tx)
+		if err != nil {
+			return err
+		}
+		columns := make([]string, 0, len(defaults))
+		for name, value := range defaults {
+			field, err := setField(txCtx, s, obj, name, value)
+			if err != nil {
+				return err
+			}
+			columns = append(columns, field.DBName)
+		}
+		return tx.Model(obj).Select(columns).Updates(obj).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return obj, created, nil
+}
+
+// build returns a new instance with the values of the exact lookups in
+// args, then defaults
+func (qs QuerySet[T]) build(ctx context.Context, defaults map[string]interface{}, args []interface{}) (*T, error) {
+	conn, err := Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := qs.schema(conn)
+	if err != nil {
+		return nil, err
+	}
+	list, err := pairs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := new(T)
+	for _, l := range list {
+		name, kind, found := strings.Cut(l.key, "__")
+		if found && kind != "exact" {
+			continue
+		}
+		if _, err := setField(ctx, s, obj, name, l.value); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range defaults {
+		if _, err := setField(ctx, s, obj, name, value); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// schema parses model T
+func (qs QuerySet[T]) schema(conn *gorm.DB) (*schema.Schema, error) {
+	model := new(T)
+	stmt := &gorm.Statement{DB: conn}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	return stmt.Schema, nil
+}
+
+// setField sets the named field of obj, by Go or column name
+func setField(ctx context.Context, s *schema.Schema, obj interface{}, name string, value interface{}) (*schema.Field, error) {
+	field := s.LookUpField(name)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+	if err := field.Set(ctx, reflect.ValueOf(obj).Elem(), value); err != nil {
+		return nil, fmt.Errorf("field %s: %w", name, err)
+	}
+	return field, nil
+}
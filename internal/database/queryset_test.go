@@ -0,0 +1,299 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"going/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// qsItem is the model queried in the QuerySet tests
+type qsItem struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+	Age  int
+	Note *string
+}
+
+// querySetContext returns a context carrying a fresh in-memory database
+// with the qs_items table
+func querySetContext(t *testing.T) context.Context {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Database.Name = ":memory:"
+	cfg.Database.LogLevel = "silent"
+	d, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	if err := d.Default().AutoMigrate(&qsItem{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewContext(context.Background(), d)
+}
+
+// whereOf returns the WHERE and ORDER BY part of the SELECT a QuerySet
+// runs, and its arguments, without running it
+func whereOf(t *testing.T, ctx context.Context, qs QuerySet[qsItem]) (string, []interface{}, error) {
+	t.Helper()
+
+	db, _, err := qs.query(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Find(&[]qsItem{}).Statement
+	sql := strings.TrimPrefix(stmt.SQL.String(), "SELECT * FROM `qs_items` ")
+	return sql, stmt.Vars, nil
+}
+
+func TestLookupSQL(t *testing.T) {
+	ctx := querySetContext(t)
+
+	tests := []struct {
+		key   string
+		value interface{}
+		sql   string
+		vars  []interface{}
+	}{
+		{"name", "a", "WHERE `qs_items`.`name` = ?", []interface{}{"a"}},
+		{"Name__exact", "a", "WHERE `qs_items`.`name` = ?", []interface{}{"a"}},
+		{"note", nil, "WHERE `qs_items`.`note` IS NULL", nil},
+		{"name__iexact", "A", "WHERE LOWER(`qs_items`.`name`) = LOWER(?)", []interface{}{"A"}},
+		{"age__in", []int{1, 2}, "WHERE `qs_items`.`age` IN (?,?)", []interface{}{1, 2}},
+		{"age__in", []int{}, "WHERE 1 = 0", nil},
+		{"age__gt", 1, "WHERE `qs_items`.`age` > ?", []interface{}{1}},
+		{"age__gte", 1, "WHERE `qs_items`.`age` >= ?", []interface{}{1}},
+		{"age__lt", 1, "WHERE `qs_items`.`age` < ?", []interface{}{1}},
+		{"age__lte", 1, "WHERE `qs_items`.`age` <= ?", []interface{}{1}},
+		{"age__range", [2]int{1, 5}, "WHERE `qs_items`.`age` BETWEEN ? AND ?", []interface{}{1, 5}},
+		{"note__isnull", true, "WHERE `qs_items`.`note` IS NULL", nil},
+		{"note__isnull", false, "WHERE `qs_items`.`note` IS NOT NULL", nil},
+		{"name__contains", "50%", "WHERE `qs_items`.`name` LIKE ? ESCAPE '!'", []interface{}{"%50!%%"}},
+		{"name__icontains", "a_b", "WHERE LOWER(`qs_items`.`name`) LIKE LOWER(?) ESCAPE '!'", []interface{}{"%a!_b%"}},
+		{"name__startswith", "wow!", "WHERE `qs_items`.`name` LIKE ? ESCAPE '!'", []interface{}{"wow!!%"}},
+		{"name__istartswith", "a", "WHERE LOWER(`qs_items`.`name`) LIKE LOWER(?) ESCAPE '!'", []interface{}{"a%"}},
+		{"name__endswith", "a", "WHERE `qs_items`.`name` LIKE ? ESCAPE '!'", []interface{}{"%a"}},
+		{"name__iendswith", "a", "WHERE LOWER(`qs_items`.`name`) LIKE LOWER(?) ESCAPE '!'", []interface{}{"%a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sql, vars, err := whereOf(t, ctx, Objects[qsItem]().Filter(tt.key, tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", sql, tt.sql)
+			}
+			if (len(vars) != 0 || len(tt.vars) != 0) && !reflect.DeepEqual(vars, tt.vars) {
+				t.Errorf("vars = %#v, want %#v", vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestQuerySetSQL(t *testing.T) {
+	ctx := querySetContext(t)
+
+	tests := []struct {
+		name string
+		qs   QuerySet[qsItem]
+		sql  string
+		vars []interface{}
+	}{
+		{
+			name: "filters are ANDed",
+			qs:   Objects[qsItem]().Filter("name", "a", "age__gte", 3).Filter("note__isnull", false),
+			sql:  "WHERE (`qs_items`.`name` = ? AND `qs_items`.`age` >= ?) AND `qs_items`.`note` IS NOT NULL",
+			vars: []interface{}{"a", 3},
+		},
+		{
+			name: "exclude negates its lookups together",
+			qs:   Objects[qsItem]().Exclude("age__in", []int{1, 2}, "note__isnull", true),
+			sql:  "WHERE NOT ((`qs_items`.`age` IN (?,?) AND `qs_items`.`note` IS NULL))",
+			vars: []interface{}{1, 2},
+		},
+		{
+			name: "order by",
+			qs:   Objects[qsItem]().OrderBy("-age", "Name"),
+			sql:  "ORDER BY `qs_items`.`age` DESC,`qs_items`.`name`",
+		},
+		{
+			name: "order by replaces the ordering",
+			qs:   Objects[qsItem]().OrderBy("name").OrderBy("id"),
+			sql:  "ORDER BY `qs_items`.`id`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars, err := whereOf(t, ctx, tt.qs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", sql, tt.sql)
+			}
+			if (len(vars) != 0 || len(tt.vars) != 0) && !reflect.DeepEqual(vars, tt.vars) {
+				t.Errorf("vars = %#v, want %#v", vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestQuerySetErrors(t *testing.T) {
+	ctx := querySetContext(t)
+
+	tests := []struct {
+		name string
+		qs   QuerySet[qsItem]
+		want string
+	}{
+		{"unknown lookup", Objects[qsItem]().Filter("name__regex", "a"), `unsupported lookup "regex" in name__regex`},
+		{"unknown field", Objects[qsItem]().Filter("title", "a"), `unknown field "title" in title`},
+		{"unknown field in exclude", Objects[qsItem]().Exclude("title__gt", 1), `unknown field "title" in title__gt`},
+		{"odd arguments", Objects[qsItem]().Filter("name"), "expected key and value pairs, got 1 arguments"},
+		{"key not a string", Objects[qsItem]().Filter(1, "a"), "expected a lookup string, got int"},
+		{"in without a slice", Objects[qsItem]().Filter("age__in", 1), "age__in: in lookup expects a slice, got int"},
+		{"range of three", Objects[qsItem]().Filter("age__range", []int{1, 2, 3}), "age__range: range lookup expects two values"},
+		{"isnull without a bool", Objects[qsItem]().Filter("note__isnull", "yes"), "note__isnull: isnull lookup expects a bool, got string"},
+		{"contains without a string", Objects[qsItem]().Filter("name__contains", 1), "name__contains: expected a string, got int"},
+		{"unknown ordering", Objects[qsItem]().OrderBy("-title"), `unknown field "-title" in ordering`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.qs.All(ctx); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("All: expected an error containing %q, got %v", tt.want, err)
+			}
+			if _, err := tt.qs.Count(ctx); err == nil {
+				t.Error("Count: expected an error")
+			}
+			if _, err := tt.qs.Exists(ctx); err == nil {
+				t.Error("Exists: expected an error")
+			}
+		})
+	}
+}
+
+// seedItems creates items named a to e aged 1 to 5; d and e have a note
+func seedItems(t *testing.T, ctx context.Context) {
+	t.Helper()
+
+	note := "note"
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		item := &qsItem{Name: name, Age: i + 1}
+		if i >= 3 {
+			item.Note = &note
+		}
+		if err := Objects[qsItem]().Create(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// names returns the names of the items
+func names(items []qsItem) string {
+	list := make([]string, len(items))
+	for i, item := range items {
+		list[i] = item.Name
+	}
+	return strings.Join(list, ",")
+}
+
+func TestQuerySetResults(t *testing.T) {
+	ctx := querySetContext(t)
+	seedItems(t, ctx)
+	items := Objects[qsItem]()
+
+	tests := []struct {
+		name string
+		qs   QuerySet[qsItem]
+		want string
+	}{
+		{"all", items.OrderBy("id"), "a,b,c,d,e"},
+		{"descending", items.OrderBy("-age"), "e,d,c,b,a"},
+		{"filter", items.Filter("age__gte", 2, "note__isnull", true).OrderBy("id"), "b,c"},
+		{"exclude needs every lookup to match", items.Exclude("age__lte", 2, "name", "a").OrderBy("id"), "b,c,d,e"},
+		{"exclude empty in keeps everything", items.Exclude("name__in", []string{}).OrderBy("id"), "a,b,c,d,e"},
+		{"filter and exclude", items.Filter("age__range", []int{2, 4}).Exclude("name", "c").OrderBy("id"), "b,d"},
+		{"limit and offset", items.OrderBy("id").Offset(1).Limit(2), "b,c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := tt.qs.All(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(list); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountAndExists(t *testing.T) {
+	ctx := querySetContext(t)
+	seedItems(t, ctx)
+	items := Objects[qsItem]()
+
+	tests := []struct {
+		name   string
+		qs     QuerySet[qsItem]
+		count  int64
+		exists bool
+	}{
+		{"all", items.QuerySet, 5, true},
+		{"filtered", items.Filter("note__isnull", false), 2, true},
+		{"excluded", items.Exclude("age__gt", 1), 1, true},
+		{"none", items.Filter("name__startswith", "z"), 0, false},
+		{"limited", items.Limit(3), 3, true},
+		{"offset past the end", items.Offset(5), 0, false},
+		{"offset and limit", items.Offset(3).Limit(5), 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := tt.qs.Count(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("Count = %d, want %d", count, tt.count)
+			}
+			exists, err := tt.qs.Exists(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != tt.exists {
+				t.Errorf("Exists = %v, want %v", exists, tt.exists)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := querySetContext(t)
+	seedItems(t, ctx)
+	items := Objects[qsItem]()
+
+	item, err := items.Get(ctx, "name", "c")
+	if err != nil || item.Age != 3 {
+		t.Errorf("Get(name=c) = %+v, %v", item, err)
+	}
+	if _, err := items.Get(ctx, "name", "z"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+	if _, err := items.Filter("age__gt", 1).Get(ctx); !errors.Is(err, ErrMultipleObjects) {
+		t.Errorf("expected ErrMultipleObjects, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"going/internal/signals"
+
+	"gorm.io/gorm"
+)
+
+// registerSignals sends the model signals around creates, updates and
+// deletes. Post signals run after the model's After hooks but before the
+// write's transaction commits, so their errors roll it back.
+func registerSignals(db *gorm.DB) error {
+	cb := db.Callback()
+	err := errors.Join(
+		cb.Create().Before("gorm:create").
+			Register("signals:pre_save_create", send(signals.PreSave, true)),
+		cb.Create().After("gorm:after_create").Before("gorm:commit_or_rollback_transaction").
+			Register("signals:post_save_create", send(signals.PostSave, true)),
+		cb.Update().Before("gorm:update").
+			Register("signals:pre_save_update", send(signals.PreSave, false)),
+		cb.Update().After("gorm:after_update").Before("gorm:commit_or_rollback_transaction").
+			Register("signals:post_save_update", send(signals.PostSave, false)),
+		cb.Delete().Before("gorm:delete").
+			Register("signals:pre_delete", send(signals.PreDelete, false)),
+		cb.Delete().After("gorm:after_delete").Before("gorm:commit_or_rollback_transaction").
+			Register("signals:post_delete", send(signals.PostDelete, false)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register signal callbacks: %w", err)
+	}
+	return nil
+}
+
+// send returns a callback sending sig for the statement's model. Errors
+// from receivers are added to the statement, which aborts it.
+func send(sig *signals.Signal, created bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun || db.Statement.Schema == nil || !sig.HasReceivers() {
+			return
+		}
+
+		instance := db.Statement.Model
+		if instance == nil {
+			instance = db.Statement.Dest
+		}
+		err := sig.Send(db.Statement.Context, &signals.Event{
+			Instance: instance,
+			Created:  created,
+			DB:       db,
+		})
+		if err != nil {
+			db.AddError(err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"going/internal/signals"
+
+	"gorm.io/gorm"
+)
+
+// connect connects fn to sig for the rest of the test
+func connect(t *testing.T, sig *signals.Signal, fn signals.Receiver, opts ...signals.Option) {
+	t.Cleanup(sig.Connect(fn, opts...))
+}
+
+// logSignals records the signals sent for qsItem writes
+func logSignals(t *testing.T) *[]string {
+	log := new([]string)
+	for _, sig := range []*signals.Signal{signals.PreSave, signals.PostSave, signals.PreDelete, signals.PostDelete} {
+		sig := sig
+		t.Cleanup(signals.ConnectModel(sig, func(ctx context.Context, item *qsItem, e *signals.Event) error {
+			entry := fmt.Sprintf("%s %s", sig, item.Name)
+			if e.Created {
+				entry += " created"
+			}
+			*log = append(*log, entry)
+			return nil
+		}))
+	}
+	return log
+}
+
+func TestWriteSignals(t *testing.T) {
+	ctx := querySetContext(t)
+	log := logSignals(t)
+	db, err := Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := &qsItem{Name: "a"}
+	if err := db.Create(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	item.Name = "b"
+	if err := db.Save(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	batch := []qsItem{{Name: "c"}, {Name: "d"}}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"pre_save a created", "post_save a created",
+		"pre_save b", "post_save b",
+		"pre_delete b", "post_delete b",
+		"pre_save c created", "pre_save d created", "post_save c created", "post_save d created",
+	}
+	if got := strings.Join(*log, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("signals sent:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestPreSaveChangesInstance(t *testing.T) {
+	ctx := querySetContext(t)
+	t.Cleanup(signals.ConnectModel(signals.PreSave, func(ctx context.Context, item *qsItem, e *signals.Event) error {
+		item.Name = strings.TrimSpace(item.Name)
+		return nil
+	}))
+
+	item := &qsItem{Name: "  padded  "}
+	if err := Objects[qsItem]().Create(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := Objects[qsItem]().Get(ctx, "id", item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "padded" {
+		t.Errorf("stored name %q", stored.Name)
+	}
+}
+
+func TestPreSignalErrorAbortsWrite(t *testing.T) {
+	ctx := querySetContext(t)
+	db, err := Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := &qsItem{Name: "kept"}
+	if err := db.Create(kept).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := errors.New("rejected")
+	var posts []string
+	connect(t, signals.PreSave, func(ctx context.Context, e *signals.Event) error { return rejected })
+	connect(t, signals.PreDelete, func(ctx context.Context, e *signals.Event) error { return rejected })
+	connect(t, signals.PostSave, func(ctx context.Context, e *signals.Event) error {
+		posts = append(posts, "post_save")
+		return nil
+	})
+	connect(t, signals.PostDelete, func(ctx context.Context, e *signals.Event) error {
+		posts = append(posts, "post_delete")
+		return nil
+	})
+
+	if err := db.Create(&qsItem{Name: "new"}).Error; !errors.Is(err, rejected) {
+		t.Errorf("Create: expected the receiver's error, got %v", err)
+	}
+	if err := db.Model(kept).Update("name", "changed").Error; !errors.Is(err, rejected) {
+		t.Errorf("Update: expected the receiver's error, got %v", err)
+	}
+	if err := db.Delete(kept).Error; !errors.Is(err, rejected) {
+		t.Errorf("Delete: expected the receiver's error, got %v", err)
+	}
+
+	list, err := Objects[qsItem]().All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "kept" {
+		t.Errorf("aborted writes changed the table: %+v", list)
+	}
+	if len(posts) != 0 {
+		t.Errorf("post signals sent for aborted writes: %v", posts)
+	}
+}
+
+func TestPostSignalErrorRollsBack(t *testing.T) {
+	ctx := querySetContext(t)
+	rejected := errors.New("rejected")
+	connect(t, signals.PostSave, func(ctx context.Context, e *signals.Event) error {
+		// Receivers query inside the write's transaction
+		var count int64
+		if err := e.DB.Session(&gorm.Session{NewDB: true}).Model(&qsItem{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 1 {
+			return fmt.Errorf("saw %d rows in the transaction", count)
+		}
+		return rejected
+	})
+
+	if err := Objects[qsItem]().Create(ctx, &qsItem{Name: "a"}); !errors.Is(err, rejected) {
+		t.Fatalf("expected the receiver's error, got %v", err)
+	}
+	count, err := Objects[qsItem]().Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("post_save error did not roll back the insert, found %d rows", count)
+	}
+}
@@ -0,0 +1,575 @@
+package fixtures
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"going/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Record is one serialized model instance
+type Record struct {
+	// Model is the model label, e.g. auth.user
+	Model string `json:"model" yaml:"model"`
+	// PK is the primary key; it is omitted for new rows and models with a
+	// composite key, whose key columns are in Fields
+	PK interface{} `json:"pk,omitempty" yaml:"pk,omitempty"`
+	// Fields holds the column values, and the related primary keys of
+	// many2many associations
+	Fields map[string]interface{} `json:"fields" yaml:"fields"`
+}
+
+// model is a registered model with its schema and connection
+type model struct {
+	label  string
+	conn   *gorm.DB
+	schema *schema.Schema
+}
+
+// registered returns every registered model, ordered so that models come
+// after the models their foreign keys point to
+func registered(d *database.DB) ([]*model, error) {
+	list := make([]*model, 0)
+	seen := make(map[string]bool)
+	for _, m := range database.Models() {
+		app, name := database.ModelLabel(m)
+		label := app + "." + name
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+
+		conn, err := d.For(m)
+		if err != nil {
+			return nil, err
+		}
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(m); err != nil {
+			return nil, fmt.Errorf("failed to parse model %s: %w", label, err)
+		}
+		list = append(list, &model{label: label, conn: conn, schema: stmt.Schema})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].label < list[j].label })
+	return sortDependencies(list), nil
+}
+
+// sortDependencies orders models after the ones they reference. Cycles are
+// broken arbitrarily: begin defers SQLite's foreign key checks to commit
+// and turns MySQL's off.
+func sortDependencies(list []*model) []*model {
+	byTable := make(map[string]*model, len(list))
+	for _, m := range list {
+		byTable[m.schema.Table] = m
+	}
+
+	deps := make(map[*model][]*model)
+	for _, m := range list {
+		for _, rel := range m.schema.Relationships.Relations {
+			other, ok := byTable[rel.FieldSchema.Table]
+			if !ok || other == m {
+				continue
+			}
+			switch rel.Type {
+			case schema.BelongsTo:
+				deps[m] = append(deps[m], other)
+			case schema.HasOne, schema.HasMany:
+				deps[other] = append(deps[other], m)
+			}
+		}
+	}
+
+	sorted := make([]*model, 0, len(list))
+	state := make(map[*model]int) // 1 visiting, 2 done
+	var visit func(m *model)
+	visit = func(m *model) {
+		if state[m] != 0 {
+			return
+		}
+		state[m] = 1
+		for _, dep := range deps[m] {
+			visit(dep)
+		}
+		state[m] = 2
+		sorted = append(sorted, m)
+	}
+	for _, m := range list {
+		visit(m)
+	}
+	return sorted
+}
+
+// selectModels returns the models matching labels, either an app label such
+// as auth or a model label such as auth.user, or every model if none given
+func selectModels(list []*model, labels []string) ([]*model, error) {
+	if len(labels) == 0 {
+		return list, nil
+	}
+
+	wanted := make(map[*model]bool)
+	for _, label := range labels {
+		label = strings.ToLower(label)
+		found := false
+		for _, m := range list {
+			if m.label == label || strings.HasPrefix(m.label, label+".") {
+				wanted[m] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown app or model: %s", label)
+		}
+	}
+
+	selected := make([]*model, 0, len(wanted))
+	for _, m := range list {
+		if wanted[m] {
+			selected = append(selected, m)
+		}
+	}
+	return selected, nil
+}
+
+// pk returns the primary key field, or nil for composite keys
+func (m *model) pk() *schema.Field {
+	if len(m.schema.PrimaryFields) != 1 {
+		return nil
+	}
+	return m.schema.PrimaryFields[0]
+}
+
+// many2many returns the many2many association serialized under name
+func (m *model) many2many(name string) *schema.Relationship {
+	for _, rel := range m.schema.Relationships.Many2Many {
+		if m.relName(rel) == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+// relName is the key of a many2many association in Record.Fields
+func (m *model) relName(rel *schema.Relationship) string {
+	return m.conn.NamingStrategy.ColumnName("", rel.Name)
+}
+
+// joinColumns returns the join table columns holding the owner's and the
+// related model's keys
+func joinColumns(rel *schema.Relationship) (string, string) {
+	var owner, related string
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			owner = ref.ForeignKey.DBName
+		} else {
+			related = ref.ForeignKey.DBName
+		}
+	}
+	return owner, related
+}
+
+// Dump returns the rows of the models matching labels, or of every
+// registered model if none are given. Soft deleted rows are included.
+func Dump(d *database.DB, labels []string) ([]Record, error) {
+	list, err := registered(d)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectModels(list, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0)
+	for _, m := range selected {
+		dumped, err := m.dump()
+		if err != nil {
+			return nil, fmt.Errorf("error dumping %s: %w", m.label, err)
+		}
+		records = append(records, dumped...)
+	}
+	return records, nil
+}
+
+// dump reads every row of the model, ordered by primary key
+func (m *model) dump() ([]Record, error) {
+	ctx := context.Background()
+	pk := m.pk()
+
+	query := m.conn.Unscoped()
+	if pk != nil {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: pk.DBName}})
+	}
+	rows := reflect.New(reflect.SliceOf(m.schema.ModelType))
+	if err := query.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	joins := make(map[*schema.Relationship]map[string][]interface{})
+	if pk != nil {
+		for _, rel := range m.schema.Relationships.Many2Many {
+			related, err := m.dumpJoins(rel)
+			if err != nil {
+				return nil, err
+			}
+			joins[rel] = related
+		}
+	}
+
+	records := make([]Record, 0, rows.Elem().Len())
+	for i := 0; i < rows.Elem().Len(); i++ {
+		row := rows.Elem().Index(i)
+		record := Record{Model: m.label, Fields: make(map[string]interface{})}
+
+		for _, name := range m.schema.DBNames {
+			field := m.schema.FieldsByDBName[name]
+			value, err := dumpValue(field.ReflectValueOf(ctx, row))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			if field == pk {
+				record.PK = value
+			} else {
+				record.Fields[name] = value
+			}
+		}
+
+		for rel, related := range joins {
+			pks := related[fmt.Sprint(record.PK)]
+			if pks == nil {
+				pks = make([]interface{}, 0)
+			}
+			record.Fields[m.relName(rel)] = pks
+		}
+
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// dumpJoins reads a many2many join table, returning the related keys
+// grouped by the owner's key
+func (m *model) dumpJoins(rel *schema.Relationship) (map[string][]interface{}, error) {
+	ownerCol, relatedCol := joinColumns(rel)
+	rows, err := m.conn.Table(rel.JoinTable.Table).
+		Select([]string{ownerCol, relatedCol}).
+		Order(clause.OrderBy{Columns: []clause.OrderByColumn{
+			{Column: clause.Column{Name: ownerCol}},
+			{Column: clause.Column{Name: relatedCol}},
+		}}).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := make(map[string][]interface{})
+	for rows.Next() {
+		var owner, other interface{}
+		if err := rows.Scan(&owner, &other); err != nil {
+			return nil, err
+		}
+		if b, ok := other.([]byte); ok {
+			other = string(b)
+		}
+		key := fmt.Sprint(owner)
+		if b, ok := owner.([]byte); ok {
+			key = string(b)
+		}
+		related[key] = append(related[key], other)
+	}
+	return related, rows.Err()
+}
+
+// dumpValue converts a field value to a plain value that serializes the
+// same in JSON and YAML. Binary values are base64 encoded.
+func dumpValue(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	value := v.Interface()
+	if valuer, ok := value.(driver.Valuer); ok {
+		var err error
+		if value, err = valuer.Value(); err != nil {
+			return nil, err
+		}
+	}
+
+	if b, ok := value.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return value, nil
+}
+
+// Load saves records, keeping their primary keys: existing rows are
+// updated and missing ones inserted. Models are saved after the models
+// they reference and many2many associations are replaced by the listed
+// keys. Each database is loaded in a single transaction, so nothing is
+// saved if a record fails. Model hooks are not run. It returns the number
+// of records loaded.
+func Load(d *database.DB, records []Record) (int, error) {
+	list, err := registered(d)
+	if err != nil {
+		return 0, err
+	}
+	byLabel := make(map[string]*model, len(list))
+	for _, m := range list {
+		byLabel[m.label] = m
+	}
+
+	groups := make(map[*model][]Record)
+	for i, record := range records {
+		m, ok := byLabel[strings.ToLower(record.Model)]
+		if !ok {
+			return 0, fmt.Errorf("record %d: unknown model %q", i+1, record.Model)
+		}
+		groups[m] = append(groups[m], record)
+	}
+
+	l := &loader{txs: make(map[*gorm.DB]*gorm.DB)}
+	defer l.rollback()
+
+	for _, m := range list {
+		for i, record := range groups[m] {
+			if err := l.save(m, record); err != nil {
+				return 0, fmt.Errorf("error loading %s record %d: %w", m.label, i+1, err)
+			}
+		}
+	}
+
+	// Join rows go last so both ends of each association exist
+	for _, join := range l.joins {
+		if err := join.save(); err != nil {
+			return 0, fmt.Errorf("error loading %s.%s: %w", join.model.label, join.model.relName(join.rel), err)
+		}
+	}
+
+	for _, m := range list {
+		if _, ok := groups[m]; ok {
+			if err := l.resetSequence(m); err != nil {
+				return 0, fmt.Errorf("error resetting %s sequence: %w", m.label, err)
+			}
+		}
+	}
+
+	if err := l.commit(); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// loader holds the transactions and pending join rows of a Load
+type loader struct {
+	// txs maps each connection to its open transaction
+	txs   map[*gorm.DB]*gorm.DB
+	order []*gorm.DB
+	joins []*joinRows
+}
+
+// joinRows are the related keys of a many2many association of one record
+type joinRows struct {
+	tx      *gorm.DB
+	model   *model
+	rel     *schema.Relationship
+	owner   interface{}
+	related []interface{}
+}
+
+// begin returns the transaction on the model's database, starting it on
+// first use. SQLite checks its foreign keys at commit. MySQL checks them on
+// every statement and can't defer them, so they are disabled until commit
+// or rollback and the fixture's references are trusted.
+func (l *loader) begin(m *model) (*gorm.DB, error) {
+	if tx, ok := l.txs[m.conn]; ok {
+		return tx, nil
+	}
+
+	tx := m.conn.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	l.txs[m.conn] = tx
+	l.order = append(l.order, m.conn)
+
+	switch tx.Dialector.Name() {
+	case "sqlite":
+		if err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error; err != nil {
+			return nil, err
+		}
+	case "mysql":
+		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// save builds the model instance described by record and saves it
+func (l *loader) save(m *model, record Record) error {
+	ctx := context.Background()
+	tx, err := l.begin(m)
+	if err != nil {
+		return err
+	}
+
+	instance := reflect.New(m.schema.ModelType)
+	row := instance.Elem()
+	pk := m.pk()
+
+	if record.PK != nil {
+		if pk == nil {
+			return fmt.Errorf("model has a composite primary key; set its columns in fields")
+		}
+		if err := setValue(ctx, pk, row, record.PK); err != nil {
+			return fmt.Errorf("pk: %w", err)
+		}
+	}
+
+	var joins []*joinRows
+	for name, value := range record.Fields {
+		if field, ok := m.schema.FieldsByDBName[name]; ok {
+			if err := setValue(ctx, field, row, value); err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			continue
+		}
+
+		rel := m.many2many(name)
+		if rel == nil || pk == nil {
+			return fmt.Errorf("unknown field %s", name)
+		}
+		related, ok := value.([]interface{})
+		if !ok && value != nil {
+			return fmt.Errorf("field %s: expected a list of primary keys", name)
+		}
+		joins = append(joins, &joinRows{tx: tx, model: m, rel: rel, related: related})
+	}
+
+	tx = tx.Session(&gorm.Session{SkipHooks: true}).Omit(clause.Associations)
+
+	// Insert a copy if the row is missing: GORM swaps zero values for column
+	// defaults on insert, so the update below writes the values as given
+	created := reflect.New(m.schema.ModelType)
+	created.Elem().Set(row)
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(created.Interface()).Error; err != nil {
+		return err
+	}
+	for _, field := range m.schema.PrimaryFields {
+		if _, zero := field.ValueOf(ctx, row); zero {
+			value, _ := field.ValueOf(ctx, created.Elem())
+			if err := field.Set(ctx, row, value); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Save(instance.Interface()).Error; err != nil {
+		return err
+	}
+
+	for _, join := range joins {
+		join.owner, _ = pk.ValueOf(ctx, row)
+	}
+	l.joins = append(l.joins, joins...)
+	return nil
+}
+
+// save replaces the join rows of the owner with the related keys
+func (j *joinRows) save() error {
+	ownerCol, relatedCol := joinColumns(j.rel)
+	table := j.rel.JoinTable.Table
+
+	err := j.tx.Table(table).
+		Where(clause.Eq{Column: clause.Column{Name: ownerCol}, Value: j.owner}).
+		Delete(map[string]interface{}{}).Error
+	if err != nil {
+		return err
+	}
+	if len(j.related) == 0 {
+		return nil
+	}
+
+	rows := make([]map[string]interface{}, len(j.related))
+	for i, related := range j.related {
+		rows[i] = map[string]interface{}{ownerCol: j.owner, relatedCol: related}
+	}
+	return j.tx.Table(table).Create(&rows).Error
+}
+
+// resetSequence moves a PostgreSQL serial sequence past the loaded keys, so
+// later inserts don't reuse them. Other databases do this themselves.
+func (l *loader) resetSequence(m *model) error {
+	pk := m.pk()
+	tx := l.txs[m.conn]
+	if pk == nil || !pk.AutoIncrement || tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	column := clause.Column{Name: pk.DBName}
+	return tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(?), 1), MAX(?) IS NOT NULL) FROM ?",
+		m.schema.Table, pk.DBName, column, column, clause.Table{Name: m.schema.Table}).Error
+}
+
+// commit commits every transaction in the order they were started
+func (l *loader) commit() error {
+	for len(l.order) > 0 {
+		conn := l.order[0]
+		tx := l.txs[conn]
+		if tx.Dialector.Name() == "mysql" {
+			if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			return fmt.Errorf("failed to commit fixtures: %w", err)
+		}
+		delete(l.txs, conn)
+		l.order = l.order[1:]
+	}
+	return nil
+}
+
+// rollback rolls back the transactions that were not committed
+func (l *loader) rollback() {
+	for _, conn := range l.order {
+		tx := l.txs[conn]
+		if tx.Dialector.Name() == "mysql" {
+			tx.Exec("SET FOREIGN_KEY_CHECKS = 1")
+		}
+		tx.Rollback()
+	}
+}
+
+// setValue sets a field from a decoded value. Times are parsed from RFC 3339
+// strings and binary values decoded from base64.
+func setValue(ctx context.Context, field *schema.Field, row reflect.Value, value interface{}) error {
+	if s, ok := value.(string); ok {
+		switch {
+		case field.DataType == schema.Time:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			value = t
+		case field.IndirectFieldType.Kind() == reflect.Slice && field.IndirectFieldType.Elem().Kind() == reflect.Uint8:
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			value = b
+		}
+	}
+	return field.Set(ctx, row, value)
+}
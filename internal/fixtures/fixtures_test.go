@@ -0,0 +1,152 @@
+package fixtures
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"going/internal/auth"
+	"going/internal/database"
+	"going/internal/testing/factory"
+)
+
+// seed fills db with users, groups and permissions. Deleting a user leaves
+// a gap in the primary keys, which loading must keep.
+func seed(t *testing.T, db *database.DB) {
+	t.Helper()
+
+	conn := db.Default()
+	perms := []auth.Permission{
+		{Name: "Can add post", App: "blog", Codename: "add_post"},
+		{Name: "Can delete post", App: "blog", Codename: "delete_post"},
+	}
+	if err := conn.Create(&perms).Error; err != nil {
+		t.Fatal(err)
+	}
+	editors := auth.Group{Name: "editors", Permissions: perms}
+	if err := conn.Create(&editors).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	users := []*auth.User{
+		{Username: "alice", IsActive: true, IsStaff: true, Groups: []auth.Group{editors}},
+		{Username: "removed", IsActive: true},
+		{Username: "bob", IsActive: false, Permissions: perms[1:]},
+	}
+	for _, user := range users {
+		if err := conn.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := conn.Delete(users[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encoded dumps every model of db in format
+func encoded(t *testing.T, db *database.DB, format string) string {
+	t.Helper()
+
+	records, err := Dump(db, nil)
+	if err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, records, format); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.String()
+}
+
+func TestDumpLoadRoundTrip(t *testing.T) {
+	src := factory.DB(t)
+	seed(t, src)
+
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			dumped := encoded(t, src, format)
+			falseValue := map[string]string{"json": `"is_active": false`, "yaml": "is_active: false"}[format]
+			if !strings.Contains(dumped, falseValue) {
+				t.Errorf("false booleans missing from the fixture:\n%s", dumped)
+			}
+
+			records, err := Decode(bytes.NewBufferString(dumped), format)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			dst := factory.DB(t)
+			count, err := Load(dst, records)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if count != len(records) {
+				t.Errorf("loaded %d records, want %d", count, len(records))
+			}
+
+			var users []auth.User
+			if err := dst.Default().Preload("Groups").Preload("Permissions").Order("id").Find(&users).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || users[0].ID != 1 || users[1].ID != 3 {
+				t.Fatalf("expected users 1 and 3, got %+v", users)
+			}
+			alice, bob := users[0], users[1]
+			if !alice.IsActive || !alice.IsStaff || bob.IsActive || bob.IsStaff {
+				t.Errorf("booleans not kept: alice active=%v staff=%v, bob active=%v staff=%v",
+					alice.IsActive, alice.IsStaff, bob.IsActive, bob.IsStaff)
+			}
+			if len(alice.Groups) != 1 || alice.Groups[0].Name != "editors" {
+				t.Errorf("alice's groups = %+v", alice.Groups)
+			}
+			if len(bob.Permissions) != 1 || bob.Permissions[0].Codename != "delete_post" {
+				t.Errorf("bob's permissions = %+v", bob.Permissions)
+			}
+
+			var group auth.Group
+			if err := dst.Default().Preload("Permissions").First(&group, "name = ?", "editors").Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(group.Permissions) != 2 {
+				t.Errorf("editors have %d permissions, want 2", len(group.Permissions))
+			}
+
+			// Dumping the loaded database gives the same fixture
+			if again := encoded(t, dst, format); again != dumped {
+				t.Errorf("round trip changed the fixture:\n%s\nwant:\n%s", again, dumped)
+			}
+
+			// New rows don't reuse loaded keys
+			user := auth.User{Username: "carol"}
+			if err := dst.Default().Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.ID <= 3 {
+				t.Errorf("new user got id %d", user.ID)
+			}
+		})
+	}
+}
+
+func TestLoadRollsBackOnError(t *testing.T) {
+	db := factory.DB(t)
+
+	records := []Record{
+		{Model: "auth.group", PK: int64(1), Fields: map[string]interface{}{"name": "editors"}},
+		{Model: "auth.group", PK: int64(2), Fields: map[string]interface{}{"no_such_field": true}},
+	}
+	if _, err := Load(db, records); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	var count int64
+	if err := db.Default().Model(&auth.Group{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected the failed load to be rolled back, found %d groups", count)
+	}
+
+	if _, err := Load(db, []Record{{Model: "blog.missing"}}); err == nil {
+		t.Error("expected an error for an unknown model")
+	}
+}
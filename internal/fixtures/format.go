@@ -0,0 +1,88 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FormatFromPath returns the format of a fixture file from its extension:
+// json for .json, yaml for .yaml and .yml
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	default:
+		return "", fmt.Errorf("unknown fixture format for %s (expected .json, .yaml or .yml)", path)
+	}
+}
+
+// Encode writes records as json or yaml
+func Encode(w io.Writer, records []Record, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported fixture format: %s", format)
+	}
+}
+
+// Decode reads records written as json or yaml
+func Decode(r io.Reader, format string) ([]Record, error) {
+	var records []Record
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		if err := decoder.Decode(&records); err != nil {
+			return nil, fmt.Errorf("error parsing fixture: %w", err)
+		}
+	case "yaml":
+		if err := yaml.NewDecoder(r).Decode(&records); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error parsing fixture: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format: %s", format)
+	}
+
+	for i := range records {
+		records[i].PK = normalize(records[i].PK)
+		for name, value := range records[i].Fields {
+			records[i].Fields[name] = normalize(value)
+		}
+	}
+	return records, nil
+}
+
+// normalize turns JSON numbers into int64 or float64, so both formats
+// decode to the same values
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	}
+	return value
+}
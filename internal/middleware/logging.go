@@ -23,13 +23,14 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the request details
 		log.Printf(
-			"[%s] %s %s %d %s %s",
+			"[%s] %s %s %d %s %s %s",
 			r.Method,
 			r.URL.Path,
 			r.Proto,
 			lrw.statusCode,
 			duration,
 			r.UserAgent(),
+			RequestIDFromContext(r.Context()),
 		)
 	})
 }
@@ -0,0 +1,344 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Changes holds the statements needed to bring the live schema in line
+// with the registered models, and the statements that revert them
+type Changes struct {
+	Up   []string
+	Down []string
+}
+
+// Empty reports whether no schema changes were detected
+func (c *Changes) Empty() bool {
+	return len(c.Up) == 0
+}
+
+// Detect compares the GORM schema of every model with the tables in db and
+// returns the CREATE, ALTER and DROP statements needed to reconcile them
+func Detect(db *gorm.DB, models []interface{}) (*Changes, error) {
+	changes := &Changes{}
+	migrator := db.Migrator()
+
+	tables, err := migrator.GetTables()
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+	existing := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		existing[table] = true
+	}
+
+	managed := make(map[string]bool)
+	newModels := make([]interface{}, 0)
+	joinTables := make([]*schema.Schema, 0)
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("error parsing model %T: %w", model, err)
+		}
+		table := stmt.Schema.Table
+		managed[table] = true
+
+		// Many2many join tables have no model of their own
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if rel.JoinTable != nil && !managed[rel.JoinTable.Table] {
+				managed[rel.JoinTable.Table] = true
+				joinTables = append(joinTables, rel.JoinTable)
+			}
+		}
+
+		if !existing[table] {
+			newModels = append(newModels, model)
+			continue
+		}
+
+		if err := diffTable(db, model, stmt.Schema, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create new tables in dependency order
+	if len(newModels) > 0 {
+		sqls, err := capture(db, func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(newModels...)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error generating CREATE TABLE: %w", err)
+		}
+		changes.Up = append(changes.Up, sqls...)
+
+		for i := len(newModels) - 1; i >= 0; i-- {
+			stmt := &gorm.Statement{DB: db}
+			if err := stmt.Parse(newModels[i]); err != nil {
+				return nil, err
+			}
+			changes.Down = append(changes.Down, fmt.Sprintf("DROP TABLE %s;", stmt.Quote(stmt.Schema.Table)))
+		}
+	}
+
+	// Join tables go after the tables they reference
+	sort.Slice(joinTables, func(i, j int) bool { return joinTables[i].Table < joinTables[j].Table })
+	for _, join := range joinTables {
+		model := reflect.New(join.ModelType).Interface()
+		joinDB := db.Table(join.Table)
+
+		if existing[join.Table] {
+			if err := diffTable(joinDB, model, join, changes); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		sqls, err := capture(joinDB, func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(model)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error generating CREATE TABLE for %s: %w", join.Table, err)
+		}
+		changes.Up = append(changes.Up, sqls...)
+		changes.Down = append([]string{fmt.Sprintf("DROP TABLE %s;", db.Statement.Quote(join.Table))}, changes.Down...)
+	}
+
+	// Tables without a model are reported but never dropped automatically
+	orphans := make([]string, 0)
+	for _, table := range tables {
+		if managed[table] || isInternalTable(table) {
+			continue
+		}
+		orphans = append(orphans, table)
+	}
+	sort.Strings(orphans)
+	for _, table := range orphans {
+		changes.Up = append(changes.Up,
+			fmt.Sprintf("-- Table %s has no registered model; uncomment to drop it\n-- DROP TABLE %s;", table, db.Statement.Quote(table)))
+	}
+
+	return changes, nil
+}
+
+// diffTable adds the column and index changes for an existing table
+func diffTable(db *gorm.DB, model interface{}, sch *schema.Schema, changes *Changes) error {
+	migrator := db.Migrator()
+	quote := db.Statement.Quote
+
+	columnTypes, err := migrator.ColumnTypes(sch.Table)
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %w", sch.Table, err)
+	}
+	columns := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, col := range columnTypes {
+		columns[col.Name()] = col
+	}
+
+	for _, dbName := range sch.DBNames {
+		field := sch.FieldsByDBName[dbName]
+		if field.IgnoreMigration {
+			continue
+		}
+
+		col, exists := columns[dbName]
+		if !exists {
+			sqls, err := capture(db, func(tx *gorm.DB) error {
+				return tx.Migrator().AddColumn(model, dbName)
+			})
+			if err != nil {
+				return fmt.Errorf("error generating ADD COLUMN for %s.%s: %w", sch.Table, dbName, err)
+			}
+			changes.Up = append(changes.Up, sqls...)
+			changes.Down = append([]string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", quote(sch.Table), quote(dbName))}, changes.Down...)
+			continue
+		}
+
+		// SQLite cannot alter a column in place, so type changes are
+		// flagged for a hand-written table rebuild
+		want := baseType(migrator.FullDataTypeOf(field).SQL)
+		have := baseType(col.DatabaseTypeName())
+		if want != have {
+			changes.Up = append(changes.Up,
+				fmt.Sprintf("-- Column %s.%s changed type from %s to %s; rebuild the table by hand", sch.Table, dbName, have, want))
+		}
+	}
+
+	// Walk removed columns by name, so the output doesn't change between runs
+	removed := make([]string, 0)
+	for name := range columns {
+		if _, ok := sch.FieldsByDBName[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes.Up = append(changes.Up, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", quote(sch.Table), quote(name)))
+		changes.Down = append([]string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", quote(sch.Table), quote(name), columns[name].DatabaseTypeName())}, changes.Down...)
+	}
+
+	declared := sch.ParseIndexes()
+	if err := undeclaredIndexes(db, model, sch, declared, changes); err != nil {
+		return err
+	}
+
+	added := make([]string, 0)
+	for name := range declared {
+		if !migrator.HasIndex(model, name) {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		sqls, err := capture(db, func(tx *gorm.DB) error {
+			return tx.Migrator().CreateIndex(model, name)
+		})
+		if err != nil {
+			return fmt.Errorf("error generating CREATE INDEX %s: %w", name, err)
+		}
+		changes.Up = append(changes.Up, sqls...)
+		changes.Down = append([]string{fmt.Sprintf("DROP INDEX %s;", quote(name))}, changes.Down...)
+	}
+
+	return nil
+}
+
+// undeclaredIndexes reports the indexes of an existing table that the
+// model no longer declares. Like tables without a model, they are never
+// dropped automatically.
+func undeclaredIndexes(db *gorm.DB, model interface{}, sch *schema.Schema, declared map[string]schema.Index, changes *Changes) error {
+	// The SQLite migrator logs its queries; keep them out of the output
+	indexes, err := db.Session(&gorm.Session{Logger: &recorder{}}).Migrator().GetIndexes(model)
+	if err != nil {
+		return fmt.Errorf("error reading indexes of %s: %w", sch.Table, err)
+	}
+
+	names := make([]string, 0)
+	for _, idx := range indexes {
+		if primary, _ := idx.PrimaryKey(); primary {
+			continue
+		}
+		if _, ok := declared[idx.Name()]; ok {
+			continue
+		}
+		// Unique columns get an index from their constraint
+		if unique, _ := idx.Unique(); unique && len(idx.Columns()) == 1 {
+			if field := sch.LookUpField(idx.Columns()[0]); field != nil && field.Unique {
+				continue
+			}
+		}
+		names = append(names, idx.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sqls, err := capture(db, func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(model, name)
+		})
+		if err != nil {
+			return fmt.Errorf("error generating DROP INDEX %s: %w", name, err)
+		}
+		changes.Up = append(changes.Up,
+			fmt.Sprintf("-- Index %s on %s is no longer declared; uncomment to drop it\n-- %s", name, sch.Table, strings.Join(sqls, "\n-- ")))
+	}
+	return nil
+}
+
+// Write saves the changes as the next numbered migration in dir and
+// returns the path of the up file. The version follows every existing
+// migration, including files for other drivers.
+func Write(dir, driver, name string, changes *Changes) (string, error) {
+	list, err := Load(dir, driver)
+	if err != nil {
+		return "", err
+	}
+
+	var version int64 = 1
+	if len(list) > 0 {
+		version = list[len(list)-1].Version + 1
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if match := fileRe.FindStringSubmatch(entry.Name()); match != nil {
+			if v, err := strconv.ParseInt(match[1], 10, 64); err == nil && v >= version {
+				version = v + 1
+			}
+		}
+	}
+
+	if name == "" {
+		name = "auto_" + time.Now().Format("20060102_1504")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating migrations directory: %w", err)
+	}
+
+	mig := &Migration{Version: version, Name: name}
+	upPath := filepath.Join(dir, mig.ID()+".up.sql")
+	downPath := filepath.Join(dir, mig.ID()+".down.sql")
+
+	if err := os.WriteFile(upPath, []byte(strings.Join(changes.Up, "\n")+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("error writing migration: %w", err)
+	}
+	if len(changes.Down) > 0 {
+		if err := os.WriteFile(downPath, []byte(strings.Join(changes.Down, "\n")+"\n"), 0644); err != nil {
+			return "", fmt.Errorf("error writing migration: %w", err)
+		}
+	}
+
+	return upPath, nil
+}
+
+// capture runs fn against a dry-run session and returns the SQL it issued
+func capture(db *gorm.DB, fn func(tx *gorm.DB) error) ([]string, error) {
+	rec := &recorder{}
+	tx := db.Session(&gorm.Session{DryRun: true, Logger: rec})
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+	return rec.sqls, nil
+}
+
+// recorder is a GORM logger that collects the SQL of each statement
+type recorder struct {
+	sqls []string
+}
+
+func (r *recorder) LogMode(logger.LogLevel) logger.Interface      { return r }
+func (r *recorder) Info(context.Context, string, ...interface{})  {}
+func (r *recorder) Warn(context.Context, string, ...interface{})  {}
+func (r *recorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *recorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.sqls = append(r.sqls, strings.TrimSuffix(sql, ";")+";")
+}
+
+// baseType normalizes a column type for comparison, e.g. "varchar(255)"
+// and "VARCHAR" both become "varchar"
+func baseType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if i := strings.IndexAny(t, " ("); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+// isInternalTable reports whether a table belongs to the database engine
+// or to the migrations subsystem
+func isInternalTable(table string) bool {
+	return table == SchemaMigration{}.TableName() || strings.HasPrefix(table, "sqlite_")
+}
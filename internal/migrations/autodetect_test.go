@@ -0,0 +1,159 @@
+package migrations_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"going/internal/auth"
+	"going/internal/migrations"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns an empty SQLite database private to the test
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestDetectCreatesJoinTables(t *testing.T) {
+	db := openTestDB(t)
+	models := []interface{}{&auth.Permission{}, &auth.Group{}, &auth.User{}}
+
+	changes, err := migrations.Detect(db, models)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+
+	dir := t.TempDir()
+	if _, err := migrations.Write(dir, "sqlite3", "initial", changes); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	list, err := migrations.Load(dir, "sqlite3")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := migrations.NewMigrator(db, list).Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	for _, table := range []string{"auth_permission", "auth_group", "auth_user", "auth_user_groups", "auth_user_permissions", "auth_group_permissions"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+
+	// Many2many writes need the join tables
+	perm := auth.Permission{Name: "Can add post", App: "blog", Codename: "add_post"}
+	group := auth.Group{Name: "editors", Permissions: []auth.Permission{perm}}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("failed to create group with permissions: %v", err)
+	}
+
+	changes, err = migrations.Detect(db, models)
+	if err != nil {
+		t.Fatalf("Detect after migrating: %v", err)
+	}
+	if !changes.Empty() {
+		t.Errorf("expected no changes after migrating, got:\n%s", strings.Join(changes.Up, "\n"))
+	}
+
+	// Down drops the join tables before the tables they reference
+	if _, err := migrations.NewMigrator(db, list).Down(1); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	for _, table := range []string{"auth_user", "auth_user_groups"} {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("table %s was not dropped", table)
+		}
+	}
+}
+
+func TestDetectReportsOrphanTables(t *testing.T) {
+	db := openTestDB(t)
+	for _, sql := range []string{
+		"CREATE TABLE legacy (id integer)",
+		"CREATE TABLE auth_group_permissions (group_id integer, permission_id integer, PRIMARY KEY (group_id, permission_id))",
+	} {
+		if err := db.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := migrations.Detect(db, []interface{}{&auth.Group{}, &auth.Permission{}})
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+
+	up := strings.Join(changes.Up, "\n")
+	if !strings.Contains(up, "-- DROP TABLE `legacy`") {
+		t.Errorf("expected legacy to be reported as an orphan:\n%s", up)
+	}
+	if strings.Contains(up, "auth_group_permissions") {
+		t.Errorf("join table reported as an orphan:\n%s", up)
+	}
+}
+
+// gadget has lost its legacy columns and index, and gained a name index
+type gadget struct {
+	ID   uint
+	Name string `gorm:"index"`
+	Code string `gorm:"unique"`
+}
+
+func TestDetectDiffIsStable(t *testing.T) {
+	db := openTestDB(t)
+	for _, sql := range []string{
+		"CREATE TABLE gadgets (id integer PRIMARY KEY, name text, code text UNIQUE, zeta text, beta integer, mu real)",
+		"CREATE INDEX idx_gadgets_zeta ON gadgets (zeta)",
+		"CREATE INDEX idx_gadgets_beta ON gadgets (beta)",
+	} {
+		if err := db.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := migrations.Detect(db, []interface{}{&gadget{}})
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	up := strings.Join(changes.Up, "\n")
+	want := strings.Join([]string{
+		"ALTER TABLE `gadgets` DROP COLUMN `beta`;",
+		"ALTER TABLE `gadgets` DROP COLUMN `mu`;",
+		"ALTER TABLE `gadgets` DROP COLUMN `zeta`;",
+		"-- Index idx_gadgets_beta on gadgets is no longer declared; uncomment to drop it",
+		"-- DROP INDEX `idx_gadgets_beta`;",
+		"-- Index idx_gadgets_zeta on gadgets is no longer declared; uncomment to drop it",
+		"-- DROP INDEX `idx_gadgets_zeta`;",
+		"CREATE INDEX `idx_gadgets_name` ON `gadgets`(`name`);",
+	}, "\n")
+	if up != want {
+		t.Fatalf("up:\n%s\nwant:\n%s", up, want)
+	}
+
+	// Map order must not leak into the generated files
+	for i := 0; i < 10; i++ {
+		again, err := migrations.Detect(db, []interface{}{&gadget{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(again.Up, "\n") + strings.Join(again.Down, "\n"); got != up+strings.Join(changes.Down, "\n") {
+			t.Fatalf("run %d generated different changes:\n%s", i, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Func is a migration step written in Go
+type Func func(tx *gorm.DB) error
+
+// Migration is a single versioned schema change. Each direction is either
+// raw SQL or a Go function.
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	UpFunc   Func
+	DownFunc Func
+}
+
+// ID returns the migration's file-style identifier, e.g. 0001_create_users
+func (m *Migration) ID() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// HasDown reports whether the migration can be rolled back
+func (m *Migration) HasDown() bool {
+	return m.DownSQL != "" || m.DownFunc != nil
+}
+
+var (
+	registryMu sync.Mutex
+	registered = make([]*Migration, 0)
+
+	// fileRe matches migration files such as 0001_create_users.up.sql or,
+	// for a single driver, 0001_create_users.postgres.up.sql
+	fileRe = regexp.MustCompile(`^(\d+)_(\w+)(?:\.(\w+))?\.(up|down)\.sql$`)
+)
+
+// Register registers a Go migration. It is meant to be called from the init
+// function of a package the binary imports, such as an app; apps usually
+// list their migrations in AppConfig.Migrations instead.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registered = append(registered, &m)
+}
+
+// Load reads the SQL migrations in dir for the given database driver and
+// merges them with the registered Go migrations, sorted by version. Files
+// named for the driver take precedence over generic ones and files for
+// other drivers are skipped. A missing directory is not an error.
+func Load(dir, driver string) ([]*Migration, error) {
+	byVersion := make(map[int64]*Migration)
+	// specific records the steps that came from driver-specific files
+	specific := make(map[string]bool)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading migrations directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		if match[3] != "" && match[3] != driver {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by both %s and %s", version, m.Name, match[2])
+		}
+
+		step := match[1] + "." + match[4]
+		if match[3] == "" && specific[step] {
+			continue
+		}
+		if match[3] != "" {
+			specific[step] = true
+		}
+
+		if match[4] == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, m := range registered {
+		if existing, exists := byVersion[m.Version]; exists {
+			return nil, fmt.Errorf("migration version %d used by both %s and %s", m.Version, existing.Name, m.Name)
+		}
+		copied := *m
+		byVersion[m.Version] = &copied
+	}
+
+	list := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpSQL == "" && m.UpFunc == nil {
+			return nil, fmt.Errorf("migration %s has no up step", m.ID())
+		}
+		list = append(list, m)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
@@ -0,0 +1,262 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoDownStep is returned when rolling back a migration without a down step
+var ErrNoDownStep = errors.New("migration has no down step")
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// TableName overrides the GORM table name
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Missing is set for applied versions that no longer have a migration
+	Missing bool
+}
+
+// Migrator applies and rolls back migrations against a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*Migration
+
+	// DryRun prints the SQL that would run instead of executing it
+	DryRun bool
+	// Out receives dry-run output and progress messages
+	Out io.Writer
+}
+
+// NewMigrator creates a migrator for the given, version-sorted migrations
+func NewMigrator(db *gorm.DB, migrations []*Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		Out:        os.Stdout,
+	}
+}
+
+// Up applies every pending migration and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	return m.To(m.latestVersion())
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if err := m.rollback(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// To migrates up or down so that exactly the migrations with a version
+// less than or equal to target are applied
+func (m *Migrator) To(target int64) (int, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	// Roll back newer migrations, most recent first
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version <= target {
+			break
+		}
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if err := m.rollback(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	// Apply pending migrations, oldest first
+	for _, mig := range m.migrations {
+		if mig.Version > target {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.apply(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Status reports the state of every known and applied migration
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		record, ok := applied[mig.Version]
+		list = append(list, Status{
+			Migration: mig,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+		delete(applied, mig.Version)
+	}
+
+	// Anything left was applied but its migration is gone
+	missing := make([]Status, 0, len(applied))
+	for _, record := range applied {
+		missing = append(missing, Status{
+			Migration: &Migration{Version: record.Version, Name: record.Name},
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Migration.Version < missing[j].Migration.Version
+	})
+
+	return append(list, missing...), nil
+}
+
+// apply runs a migration's up step and records it
+func (m *Migrator) apply(mig *Migration) error {
+	if m.DryRun {
+		m.printStep(mig, "up", mig.UpSQL, mig.UpFunc)
+		return nil
+	}
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := runStep(tx, mig.UpSQL, mig.UpFunc); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error applying migration %s: %w", mig.ID(), err)
+	}
+
+	fmt.Fprintf(m.Out, "Applied %s\n", mig.ID())
+	return nil
+}
+
+// rollback runs a migration's down step and removes its record
+func (m *Migrator) rollback(mig *Migration) error {
+	if !mig.HasDown() {
+		return fmt.Errorf("error rolling back migration %s: %w", mig.ID(), ErrNoDownStep)
+	}
+
+	if m.DryRun {
+		m.printStep(mig, "down", mig.DownSQL, mig.DownFunc)
+		return nil
+	}
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := runStep(tx, mig.DownSQL, mig.DownFunc); err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{}, mig.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error rolling back migration %s: %w", mig.ID(), err)
+	}
+
+	fmt.Fprintf(m.Out, "Rolled back %s\n", mig.ID())
+	return nil
+}
+
+// printStep writes the SQL of a step for dry runs
+func (m *Migrator) printStep(mig *Migration, direction, sql string, fn Func) {
+	fmt.Fprintf(m.Out, "-- %s (%s)\n", mig.ID(), direction)
+	if fn != nil {
+		fmt.Fprintln(m.Out, "-- Go migration, SQL not available in dry run")
+		return
+	}
+	fmt.Fprintln(m.Out, sql)
+}
+
+// runStep executes either the SQL or the Go function of a step
+func runStep(tx *gorm.DB, sql string, fn Func) error {
+	if fn != nil {
+		return fn(tx)
+	}
+	return tx.Exec(sql).Error
+}
+
+// appliedVersions loads the schema_migrations table, creating it if needed
+func (m *Migrator) appliedVersions() (map[int64]SchemaMigration, error) {
+	applied := make(map[int64]SchemaMigration)
+
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		// Don't touch the schema during a dry run
+		if m.DryRun {
+			return applied, nil
+		}
+		if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+			return nil, fmt.Errorf("error creating schema_migrations table: %w", err)
+		}
+	}
+
+	var records []SchemaMigration
+	if err := m.db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// latestVersion returns the highest known migration version
+func (m *Migrator) latestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// maxCookieSize is the largest cookie value browsers reliably accept
+const maxCookieSize = 4096
+
+var (
+	// ErrCookieTooLarge is returned when a session does not fit in a cookie
+	ErrCookieTooLarge = errors.New("session too large for cookie storage")
+)
+
+// CookieEncoder is implemented by stores that keep the whole session in the
+// cookie. The cookie then holds the encoded session instead of its ID.
+type CookieEncoder interface {
+	Encode(session *Session) (string, error)
+}
+
+// cookieKeys are the keys derived from one secret
+type cookieKeys struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// CookieStore keeps sessions in the client's cookie. Values are encrypted
+// with AES-256-GCM and the result is authenticated with HMAC-SHA256, using
+// keys derived from the secret with HKDF. Cookies written with an old
+// secret are still accepted, so secrets can be rotated without logging
+// everyone out.
+type CookieStore struct {
+	keys []cookieKeys
+}
+
+// NewCookieStore creates a cookie store that encodes with secret and also
+// decodes cookies written with any of oldSecrets
+func NewCookieStore(secret string, oldSecrets ...string) (*CookieStore, error) {
+	store := &CookieStore{}
+	for _, s := range append([]string{secret}, oldSecrets...) {
+		keys, err := deriveCookieKeys(s)
+		if err != nil {
+			return nil, err
+		}
+		store.keys = append(store.keys, keys)
+	}
+	return store, nil
+}
+
+// deriveCookieKeys derives independent encryption and signing keys
+func deriveCookieKeys(secret string) (cookieKeys, error) {
+	kdf := hkdf.New(sha256.New, []byte(secret), nil, []byte("going session cookie v1"))
+
+	encKey := make([]byte, 32)
+	macKey := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, encKey); err != nil {
+		return cookieKeys{}, fmt.Errorf("error deriving session keys: %w", err)
+	}
+	if _, err := io.ReadFull(kdf, macKey); err != nil {
+		return cookieKeys{}, fmt.Errorf("error deriving session keys: %w", err)
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return cookieKeys{}, fmt.Errorf("error creating session cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return cookieKeys{}, fmt.Errorf("error creating session cipher: %w", err)
+	}
+
+	return cookieKeys{aead: aead, mac: macKey}, nil
+}
+
+// Encode serializes, encrypts and signs a session into a cookie value
+func (s *CookieStore) Encode(session *Session) (string, error) {
+	data, err := encode(session)
+	if err != nil {
+		return "", err
+	}
+
+	keys := s.keys[0]
+	nonce := make([]byte, keys.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := keys.aead.Seal(nonce, nonce, data, nil)
+	payload := base64.RawURLEncoding.EncodeToString(sealed)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(sign(keys.mac, payload))
+	if len(token) > maxCookieSize {
+		return "", ErrCookieTooLarge
+	}
+	return token, nil
+}
+
+// Get verifies, decrypts and decodes a cookie value produced by Encode
+func (s *CookieStore) Get(token string) (*Session, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	for _, keys := range s.keys {
+		if !hmac.Equal(got, sign(keys.mac, payload)) {
+			continue
+		}
+
+		nonceSize := keys.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			return nil, ErrNotFound
+		}
+		data, err := keys.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+		if err != nil {
+			return nil, ErrNotFound
+		}
+
+		session, err := decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding cookie session: %w", err)
+		}
+		if session.ExpiresAt.Before(time.Now()) {
+			return nil, ErrNotFound
+		}
+		return session, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// Save does nothing; the session is written by Encode into the cookie
+func (s *CookieStore) Save(session *Session) error {
+	return nil
+}
+
+// Delete does nothing; clearing the cookie deletes the session
+func (s *CookieStore) Delete(id string) error {
+	return nil
+}
+
+// Touch does nothing; the expiry is refreshed when the cookie is reissued
+func (s *CookieStore) Touch(id string, expiresAt time.Time) error {
+	return nil
+}
+
+// GC does nothing; expired cookies are rejected by Get
+func (s *CookieStore) GC() error {
+	return nil
+}
+
+// sign returns the HMAC-SHA256 of payload
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
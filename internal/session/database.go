@@ -0,0 +1,109 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"going/internal/apps"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	// Register sessions as a built-in app, so makemigrations creates its table
+	apps.Register(apps.AppConfig{
+		Name:   "sessions",
+		Models: []interface{}{&Record{}},
+	})
+}
+
+// Record is a session row in the sessions table
+type Record struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Data      []byte
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// TableName overrides the GORM table name
+func (Record) TableName() string {
+	return "sessions"
+}
+
+// DatabaseStore keeps sessions in the sessions table
+type DatabaseStore struct {
+	db *gorm.DB
+}
+
+// NewDatabaseStore creates a database store. Its table is created by the
+// migrations of the sessions app.
+func NewDatabaseStore(db *gorm.DB) (*DatabaseStore, error) {
+	if !db.Migrator().HasTable(&Record{}) {
+		return nil, errors.New("sessions table does not exist; run makemigrations and migrate")
+	}
+	return &DatabaseStore{db: db}, nil
+}
+
+// Get loads and decodes a session
+func (s *DatabaseStore) Get(id string) (*Session, error) {
+	var rec Record
+	err := s.db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+
+	session, err := decode(rec.Data)
+	if err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = rec.ExpiresAt
+	return session, nil
+}
+
+// Save encodes and upserts a session
+func (s *DatabaseStore) Save(session *Session) error {
+	data, err := encode(session)
+	if err != nil {
+		return err
+	}
+
+	rec := Record{
+		ID:        session.ID,
+		Data:      data,
+		ExpiresAt: session.ExpiresAt,
+	}
+	err = s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&rec).Error
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a session
+func (s *DatabaseStore) Delete(id string) error {
+	if err := s.db.Delete(&Record{}, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+// Touch extends the expiry of a session
+func (s *DatabaseStore) Touch(id string, expiresAt time.Time) error {
+	err := s.db.Model(&Record{}).Where("id = ?", id).Update("expires_at", expiresAt).Error
+	if err != nil {
+		return fmt.Errorf("error touching session: %w", err)
+	}
+	return nil
+}
+
+// GC deletes expired sessions
+func (s *DatabaseStore) GC() error {
+	if err := s.db.Delete(&Record{}, "expires_at <= ?", time.Now()).Error; err != nil {
+		return fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	return nil
+}
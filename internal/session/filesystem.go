@@ -0,0 +1,133 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FilesystemStore keeps each session in its own file under a directory
+type FilesystemStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFilesystemStore creates a filesystem store, creating dir if needed
+func NewFilesystemStore(dir string) (*FilesystemStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating session directory: %w", err)
+	}
+	return &FilesystemStore{dir: dir}, nil
+}
+
+// Get reads and decodes a session file
+func (s *FilesystemStore) Get(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	if session.ID != id || session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return session, nil
+}
+
+// Save writes a session file
+func (s *FilesystemStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(session)
+}
+
+// Delete removes a session file
+func (s *FilesystemStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+// Touch extends the expiry of a session
+func (s *FilesystemStore) Touch(id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.read(s.path(id))
+	if err != nil {
+		return err
+	}
+	session.ExpiresAt = expiresAt
+	return s.write(session)
+}
+
+// GC removes the files of expired or unreadable sessions
+func (s *FilesystemStore) GC() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("error reading session directory: %w", err)
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".session") {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		session, err := s.read(path)
+		if err != nil || session.ExpiresAt.Before(now) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// path maps a session ID to a file name. IDs come from cookies, so they
+// are hashed rather than used as paths directly.
+func (s *FilesystemStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".session")
+}
+
+func (s *FilesystemStore) read(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading session: %w", err)
+	}
+	return decode(data)
+}
+
+// write stores a session atomically by renaming a temporary file
+func (s *FilesystemStore) write(session *Session) error {
+	data, err := encode(session)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(session.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package session
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in process memory. Sessions are lost on
+// restart and are not shared between instances. Expiry times are kept in
+// a min-heap so GC only visits expired sessions.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*memoryEntry
+	expiry   expiryHeap
+}
+
+// memoryEntry is a stored session and its position in the expiry heap
+type memoryEntry struct {
+	session *Session
+	index   int
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*memoryEntry),
+	}
+}
+
+// Get returns a copy of the session with the given ID
+func (s *MemoryStore) Get(id string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, exists := s.sessions[id]
+	if !exists || entry.session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return clone(entry.session), nil
+}
+
+// Save stores a copy of the session
+func (s *MemoryStore) Save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.sessions[session.ID]; exists {
+		entry.session = clone(session)
+		heap.Fix(&s.expiry, entry.index)
+		return nil
+	}
+
+	entry := &memoryEntry{session: clone(session)}
+	s.sessions[session.ID] = entry
+	heap.Push(&s.expiry, entry)
+	return nil
+}
+
+// Delete removes a session
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, exists := s.sessions[id]; exists {
+		heap.Remove(&s.expiry, entry.index)
+		delete(s.sessions, id)
+	}
+	return nil
+}
+
+// Touch extends the expiry of a session
+func (s *MemoryStore) Touch(id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.sessions[id]
+	if !exists {
+		return ErrNotFound
+	}
+	entry.session.ExpiresAt = expiresAt
+	heap.Fix(&s.expiry, entry.index)
+	return nil
+}
+
+// GC removes expired sessions, in time proportional to how many expired
+func (s *MemoryStore) GC() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for len(s.expiry) > 0 && s.expiry[0].session.ExpiresAt.Before(now) {
+		entry := heap.Pop(&s.expiry).(*memoryEntry)
+		delete(s.sessions, entry.session.ID)
+	}
+	return nil
+}
+
+// expiryHeap orders entries by expiry time, soonest first
+type expiryHeap []*memoryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].session.ExpiresAt.Before(h[j].session.ExpiresAt)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*memoryEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type contextKey struct{}
+
+// Handle is the request-scoped session installed by Manager.Middleware.
+// The session is loaded from the store on first use, and saved with a
+// refreshed cookie when the response is written if it was modified or
+// more than half of its lifetime has passed.
+type Handle struct {
+	manager *Manager
+	request *http.Request
+
+	mu       sync.Mutex
+	session  *Session
+	loaded   bool
+	isNew    bool
+	modified bool
+	flushed  bool
+	// stale are replaced sessions, deleted when the session is saved
+	stale []string
+}
+
+// Middleware installs a lazily loaded session into each request context,
+// retrievable with FromContext
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := &Handle{manager: m, request: r}
+		sw := &sessionWriter{ResponseWriter: w, handle: h}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, h)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		// Save even if the handler wrote nothing
+		sw.commit()
+	})
+}
+
+// FromContext returns the request's session handle, or nil when the
+// request did not pass through Manager.Middleware
+func FromContext(ctx context.Context) *Handle {
+	h, _ := ctx.Value(contextKey{}).(*Handle)
+	return h
+}
+
+// ID returns the session ID
+func (h *Handle) ID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.load().ID
+}
+
+// Get returns a session value
+func (h *Handle) Get(key string) (interface{}, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	value, ok := h.load().Values[key]
+	return value, ok
+}
+
+// Set stores a session value
+func (h *Handle) Set(key string, value interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load().Values[key] = value
+	h.modified = true
+}
+
+// Delete removes a session value
+func (h *Handle) Delete(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session := h.load()
+	if _, ok := session.Values[key]; ok {
+		delete(session.Values, key)
+		h.modified = true
+	}
+}
+
+// MarkModified forces the session to be saved, e.g. after mutating a value
+// obtained with Get in place
+func (h *Handle) MarkModified() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.load()
+	h.modified = true
+}
+
+// Cycle moves the session data to a new ID and deletes the old session.
+// Call it on privilege changes such as login to prevent session fixation.
+// Like saving, the delete happens when the response is written, after the
+// request transaction of an atomic request has committed, so a database
+// store doesn't wait for the lock that transaction holds.
+func (h *Handle) Cycle() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session := h.load()
+	if !h.isNew {
+		h.stale = append(h.stale, session.ID)
+	}
+
+	session.ID = generateSessionID()
+	h.isNew = true
+	h.modified = true
+	return nil
+}
+
+// Flush deletes the session and its data and starts a new, empty session.
+// The cookie is cleared unless new values are set afterwards. The delete
+// happens when the response is written, as for Cycle.
+func (h *Handle) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session := h.load()
+	if !h.isNew {
+		h.stale = append(h.stale, session.ID)
+	}
+
+	h.session = h.manager.CreateSession()
+	h.isNew = true
+	h.modified = true
+	h.flushed = true
+	return nil
+}
+
+// load reads the session from the request cookie on first use, starting a
+// new session if there is none. The caller must hold h.mu.
+func (h *Handle) load() *Session {
+	if h.loaded {
+		return h.session
+	}
+	h.loaded = true
+
+	if cookie, err := h.request.Cookie(h.manager.name); err == nil {
+		session, err := h.manager.store.Get(cookie.Value)
+		if err == nil {
+			h.session = session
+			return session
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Error loading session: %v", err)
+		}
+	}
+
+	h.session = h.manager.CreateSession()
+	h.isNew = true
+	return h.session
+}
+
+// save persists the session and sets or clears its cookie as needed
+func (h *Handle) save(w http.ResponseWriter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.loaded {
+		return
+	}
+
+	for _, id := range h.stale {
+		if err := h.manager.store.Delete(id); err != nil {
+			log.Printf("Error deleting session: %v", err)
+		}
+	}
+	h.stale = nil
+
+	session := h.session
+	if h.flushed && len(session.Values) == 0 {
+		h.manager.ClearSessionCookie(w)
+		return
+	}
+
+	// Don't persist sessions that were only read
+	if h.isNew && !h.modified {
+		return
+	}
+
+	// Sliding expiry: refresh once half of the lifetime has passed
+	refresh := time.Until(session.ExpiresAt) < h.manager.lifetime()/2
+	if !h.modified && !refresh {
+		return
+	}
+
+	session.ExpiresAt = time.Now().Add(h.manager.lifetime())
+	if err := h.manager.SaveSession(w, session); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+}
+
+// sessionWriter saves the session just before the response headers are
+// written, so the session cookie can still be set
+type sessionWriter struct {
+	http.ResponseWriter
+	handle    *Handle
+	committed bool
+}
+
+func (sw *sessionWriter) commit() {
+	if sw.committed {
+		return
+	}
+	sw.committed = true
+	sw.handle.save(sw.ResponseWriter)
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	sw.commit()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.commit()
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
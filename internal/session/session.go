@@ -3,12 +3,17 @@ package session
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"going/internal/config"
+	"going/internal/database"
+
+	"gorm.io/gorm"
 )
 
 // Session represents a user session
@@ -20,66 +25,153 @@ type Session struct {
 
 // Manager handles session creation and management
 type Manager struct {
-	config     *config.Config
-	sessions   map[string]*Session
-	mu         sync.RWMutex
-	expiration time.Duration
-}
-
-// NewManager creates a new session manager
-func NewManager(cfg *config.Config) *Manager {
-	expiration := time.Duration(cfg.Session.Lifetime) * time.Minute
-	return &Manager{
-		config:     cfg,
-		sessions:   make(map[string]*Session),
-		expiration: expiration,
+	name  string
+	store Store
+
+	// expiration and secure can change on config reload
+	expiration atomic.Int64 // time.Duration
+	secure     atomic.Bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewManager creates a session manager using the store selected by
+// session.backend: memory (the default), database, filesystem or cookie.
+// db is only used by the database backend.
+func NewManager(cfg *config.Config, db *gorm.DB) (*Manager, error) {
+	store, err := newStore(cfg, db)
+	if err != nil {
+		return nil, err
 	}
+	return NewManagerWithStore(cfg, store), nil
 }
 
-// CreateSession creates a new session
-func (m *Manager) CreateSession() *Session {
-	sessionID := generateSessionID()
-	session := &Session{
-		ID:        sessionID,
-		Values:    make(map[string]interface{}),
-		ExpiresAt: time.Now().Add(m.expiration),
+// NewManagerWithStore creates a session manager backed by a custom store.
+// It starts a background janitor that removes expired sessions every
+// session.gc_interval seconds until Close is called.
+func NewManagerWithStore(cfg *config.Config, store Store) *Manager {
+	m := &Manager{
+		name:  cfg.Session.Name,
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	m.Reload(cfg)
+
+	interval := time.Duration(cfg.Session.GCInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
 	}
+	go m.janitor(interval)
 
-	m.mu.Lock()
-	m.sessions[sessionID] = session
-	m.mu.Unlock()
+	return m
+}
 
-	// Start a goroutine to clean up expired sessions
-	go m.cleanupExpiredSessions()
+// Reload applies the settings that can change at runtime: the session
+// lifetime and whether cookies are marked Secure
+func (m *Manager) Reload(cfg *config.Config) {
+	m.expiration.Store(int64(time.Duration(cfg.Session.Lifetime) * time.Minute))
+	m.secure.Store(!cfg.Debug)
+}
 
-	return session
+// lifetime returns the current session lifetime
+func (m *Manager) lifetime() time.Duration {
+	return time.Duration(m.expiration.Load())
+}
+
+// Close stops the background janitor. It is safe to call more than once.
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+	return nil
+}
+
+// newStore builds the store configured in session.backend
+func newStore(cfg *config.Config, db *gorm.DB) (Store, error) {
+	switch cfg.Session.Backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "database":
+		if db == nil {
+			return nil, fmt.Errorf("database session backend: %w", database.ErrNotConnected)
+		}
+		return NewDatabaseStore(db)
+	case "filesystem":
+		return NewFilesystemStore(cfg.Session.Path)
+	case "cookie":
+		return NewCookieStore(cfg.Session.Secret, cfg.Session.OldSecrets...)
+	default:
+		return nil, fmt.Errorf("unsupported session backend: %s", cfg.Session.Backend)
+	}
+}
+
+// CreateSession creates a new, unsaved session
+func (m *Manager) CreateSession() *Session {
+	return &Session{
+		ID:        generateSessionID(),
+		Values:    make(map[string]interface{}),
+		ExpiresAt: time.Now().Add(m.lifetime()),
+	}
 }
 
 // GetSession retrieves a session by ID
 func (m *Manager) GetSession(sessionID string) (*Session, error) {
-	m.mu.RLock()
-	session, exists := m.sessions[sessionID]
-	m.mu.RUnlock()
-
-	if !exists || session.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("session not found or expired")
+	session, err := m.store.Get(sessionID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update the expiration time on access
-	session.ExpiresAt = time.Now().Add(m.expiration)
+	session.ExpiresAt = time.Now().Add(m.lifetime())
+	if err := m.store.Touch(session.ID, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// SaveSession persists the session and sets its cookie on the response
+func (m *Manager) SaveSession(w http.ResponseWriter, session *Session) error {
+	value := session.ID
+	if encoder, ok := m.store.(CookieEncoder); ok {
+		var err error
+		if value, err = encoder.Encode(session); err != nil {
+			return err
+		}
+	} else if err := m.store.Save(session); err != nil {
+		return err
+	}
+
+	m.SetSessionCookie(w, value)
+	return nil
+}
+
+// RotateSession moves a session's values to a new ID and deletes the old
+// session. Call it on privilege changes such as login to prevent fixation.
+// The new session must be saved with SaveSession.
+func (m *Manager) RotateSession(old *Session) (*Session, error) {
+	session := m.CreateSession()
+	for key, value := range old.Values {
+		session.Values[key] = value
+	}
+
+	if err := m.store.Delete(old.ID); err != nil {
+		return nil, err
+	}
 	return session, nil
 }
 
 // DeleteSession removes a session
-func (m *Manager) DeleteSession(sessionID string) {
-	m.mu.Lock()
-	delete(m.sessions, sessionID)
-	m.mu.Unlock()
+func (m *Manager) DeleteSession(sessionID string) error {
+	return m.store.Delete(sessionID)
 }
 
 // GetSessionFromRequest gets the session from an HTTP request
 func (m *Manager) GetSessionFromRequest(r *http.Request) (*Session, error) {
-	cookie, err := r.Cookie(m.config.Session.Name)
+	cookie, err := r.Cookie(m.name)
 	if err != nil {
 		return nil, err
 	}
@@ -87,15 +179,16 @@ func (m *Manager) GetSessionFromRequest(r *http.Request) (*Session, error) {
 	return m.GetSession(cookie.Value)
 }
 
-// SetSessionCookie sets the session cookie on the response
+// SetSessionCookie sets the session cookie on the response. With the
+// cookie backend use SaveSession instead, which encodes the session values.
 func (m *Manager) SetSessionCookie(w http.ResponseWriter, sessionID string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     m.config.Session.Name,
+		Name:     m.name,
 		Value:    sessionID,
 		Path:     "/",
-		Expires:  time.Now().Add(m.expiration),
+		Expires:  time.Now().Add(m.lifetime()),
 		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
+		Secure:   m.secure.Load(), // HTTPS only outside of debug mode
 		SameSite: http.SameSiteLaxMode,
 	})
 }
@@ -103,7 +196,7 @@ func (m *Manager) SetSessionCookie(w http.ResponseWriter, sessionID string) {
 // ClearSessionCookie removes the session cookie
 func (m *Manager) ClearSessionCookie(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     m.config.Session.Name,
+		Name:     m.name,
 		Value:    "",
 		Path:     "/",
 		Expires:  time.Unix(0, 0),
@@ -111,19 +204,30 @@ func (m *Manager) ClearSessionCookie(w http.ResponseWriter) {
 	})
 }
 
-// cleanupExpiredSessions removes expired sessions
-func (m *Manager) cleanupExpiredSessions() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// janitor periodically removes expired sessions until Close is called
+func (m *Manager) janitor(interval time.Duration) {
+	defer close(m.done)
 
-	now := time.Now()
-	for id, session := range m.sessions {
-		if session.ExpiresAt.Before(now) {
-			delete(m.sessions, id)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanupExpiredSessions()
+		case <-m.stop:
+			return
 		}
 	}
 }
 
+// cleanupExpiredSessions removes expired sessions
+func (m *Manager) cleanupExpiredSessions() {
+	if err := m.store.GC(); err != nil {
+		log.Printf("Error cleaning up sessions: %v", err)
+	}
+}
+
 // generateSessionID generates a random session ID
 func generateSessionID() string {
 	b := make([]byte, 32)
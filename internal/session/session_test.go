@@ -0,0 +1,78 @@
+package session
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"going/internal/config"
+)
+
+// countingStore counts the janitor's GC calls
+type countingStore struct {
+	*MemoryStore
+	gcs atomic.Int32
+}
+
+func (s *countingStore) GC() error {
+	s.gcs.Add(1)
+	return s.MemoryStore.GC()
+}
+
+func TestJanitorRemovesExpiredSessions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Session.GCInterval = 1
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	m := NewManagerWithStore(cfg, store)
+	defer m.Close()
+
+	for _, s := range []*Session{
+		{ID: "expired", Values: map[string]interface{}{}, ExpiresAt: time.Now().Add(10 * time.Millisecond)},
+		{ID: "live", Values: map[string]interface{}{}, ExpiresAt: time.Now().Add(time.Hour)},
+	} {
+		if err := store.Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.gcs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if store.gcs.Load() == 0 {
+		t.Fatal("janitor did not run within 5s")
+	}
+
+	store.mu.RLock()
+	_, expired := store.sessions["expired"]
+	_, live := store.sessions["live"]
+	store.mu.RUnlock()
+	if expired || !live {
+		t.Errorf("after GC: expired session kept = %v, live session kept = %v", expired, live)
+	}
+}
+
+func TestCloseStopsJanitor(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Session.GCInterval = 1
+	m := NewManagerWithStore(cfg, NewMemoryStore())
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		// Closing again, e.g. from a second shutdown hook, must not block
+		m.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked")
+	}
+	select {
+	case <-m.done:
+	default:
+		t.Error("janitor still running after Close")
+	}
+}
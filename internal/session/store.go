@@ -0,0 +1,88 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by stores when a session does not exist or
+	// has expired
+	ErrNotFound = errors.New("session not found or expired")
+)
+
+// Store persists sessions
+type Store interface {
+	// Get returns the session with the given ID, or ErrNotFound
+	Get(id string) (*Session, error)
+	// Save creates or replaces a session
+	Save(session *Session) error
+	// Delete removes a session; deleting a missing session is not an error
+	Delete(id string) error
+	// Touch extends the expiry of an existing session
+	Touch(id string, expiresAt time.Time) error
+	// GC removes expired sessions
+	GC() error
+}
+
+// Register records the concrete type of a value stored in Session.Values so
+// it can be serialized by persistent stores. Basic types such as string,
+// int and bool need no registration.
+func Register(value interface{}) {
+	gob.Register(value)
+}
+
+// record is the serialized form of a session
+type record struct {
+	ID        string
+	Values    map[string]interface{}
+	ExpiresAt time.Time
+}
+
+// encode serializes a session with gob
+func encode(session *Session) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(record{
+		ID:        session.ID,
+		Values:    session.Values,
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding session (values of custom types must be registered with session.Register): %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decode deserializes a session encoded by encode
+func decode(data []byte) (*Session, error) {
+	var rec record
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("error decoding session: %w", err)
+	}
+
+	if rec.Values == nil {
+		rec.Values = make(map[string]interface{})
+	}
+
+	return &Session{
+		ID:        rec.ID,
+		Values:    rec.Values,
+		ExpiresAt: rec.ExpiresAt,
+	}, nil
+}
+
+// clone returns a copy of a session with its own Values map
+func clone(session *Session) *Session {
+	values := make(map[string]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	return &Session{
+		ID:        session.ID,
+		Values:    values,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
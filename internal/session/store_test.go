@@ -0,0 +1,198 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"going/internal/config"
+	"going/internal/database"
+	"going/internal/migrations"
+)
+
+// newTestDatabaseStore returns a database store on a fresh SQLite file
+func newTestDatabaseStore(t *testing.T) *DatabaseStore {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = t.TempDir()
+	cfg.Database.AutoMigrate = true
+	cfg.Database.LogLevel = "silent"
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewDatabaseStore(db.Default())
+	if err != nil {
+		t.Fatalf("NewDatabaseStore: %v", err)
+	}
+	return store
+}
+
+// Run with -race to check the stores' locking
+func TestStoresConcurrentAccess(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"database": func(t *testing.T) Store {
+			return newTestDatabaseStore(t)
+		},
+		"filesystem": func(t *testing.T) Store {
+			store, err := NewFilesystemStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			shared := &Session{ID: "shared", Values: map[string]interface{}{"n": 0}, ExpiresAt: time.Now().Add(time.Hour)}
+			if err := store.Save(shared); err != nil {
+				t.Fatal(err)
+			}
+
+			const workers, rounds = 8, 20
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*rounds*8)
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+
+					for i := 0; i < rounds; i++ {
+						own := &Session{
+							ID:        fmt.Sprintf("session-%d-%d", w, i),
+							Values:    map[string]interface{}{"worker": w, "round": i},
+							ExpiresAt: time.Now().Add(time.Hour),
+						}
+						if err := store.Save(own); err != nil {
+							errs <- err
+							continue
+						}
+						got, err := store.Get(own.ID)
+						if err != nil {
+							errs <- err
+							continue
+						}
+						if got.Values["worker"] != w || got.Values["round"] != i {
+							errs <- fmt.Errorf("session %s has values %v", own.ID, got.Values)
+						}
+						// Stores must not hand out their own copy
+						got.Values["round"] = -1
+
+						if err := store.Touch(own.ID, time.Now().Add(2*time.Hour)); err != nil {
+							errs <- err
+						}
+						if err := store.Delete(own.ID); err != nil {
+							errs <- err
+						}
+						if _, err := store.Get(own.ID); !errors.Is(err, ErrNotFound) {
+							errs <- fmt.Errorf("deleted session %s: got %v", own.ID, err)
+						}
+
+						// Writers racing on the same session
+						s := &Session{ID: shared.ID, Values: map[string]interface{}{"n": i}, ExpiresAt: time.Now().Add(time.Hour)}
+						if err := store.Save(s); err != nil {
+							errs <- err
+						}
+						if _, err := store.Get(shared.ID); err != nil {
+							errs <- err
+						}
+						if err := store.GC(); err != nil {
+							errs <- err
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCookieStoreConcurrentAccess(t *testing.T) {
+	store, err := NewCookieStore("a-long-and-random-cookie-secret", "an-older-cookie-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*20*3)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 20; i++ {
+				session := &Session{
+					ID:        generateSessionID(),
+					Values:    map[string]interface{}{"worker": w, "round": i},
+					ExpiresAt: time.Now().Add(time.Hour),
+				}
+				token, err := store.Encode(session)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				got, err := store.Get(token)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if got.ID != session.ID || got.Values["worker"] != w || got.Values["round"] != i {
+					errs <- fmt.Errorf("decoded %+v, want %+v", got, session)
+				}
+				if err := store.Delete(session.ID); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestDatabaseStoreTable(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = t.TempDir()
+	cfg.Database.LogLevel = "silent"
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := NewDatabaseStore(db.Default()); err == nil {
+		t.Fatal("expected an error without the sessions table")
+	}
+
+	// The table comes from makemigrations, as the sessions app's model
+	models, err := db.ModelsFor(config.DefaultDatabase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := migrations.Detect(db.Default(), models)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if !strings.Contains(strings.Join(changes.Up, "\n"), "CREATE TABLE `sessions`") {
+		t.Errorf("makemigrations does not create the sessions table:\n%s", strings.Join(changes.Up, "\n"))
+	}
+}
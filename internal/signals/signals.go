@@ -0,0 +1,243 @@
+// Package signals lets code react to model writes and migrations without
+// changing the code that performs them, e.g. to invalidate caches or write
+// audit logs.
+package signals
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// PreSave is sent before a model is inserted or updated. An error from
+	// a receiver aborts the write.
+	PreSave = New("pre_save")
+	// PostSave is sent after a model is inserted or updated, before the
+	// write's transaction commits
+	PostSave = New("post_save")
+	// PreDelete is sent before a model is deleted. An error from a receiver
+	// aborts the delete.
+	PreDelete = New("pre_delete")
+	// PostDelete is sent after a model is deleted, before the delete's
+	// transaction commits
+	PostDelete = New("post_delete")
+	// PostMigrate is sent after models are migrated, once per database
+	PostMigrate = New("post_migrate")
+)
+
+// Event describes what a signal is sent for
+type Event struct {
+	// Signal is the signal being sent
+	Signal *Signal
+	// Instance is the model written: a pointer to it, or the slice given
+	// for batch writes. It is nil for post_migrate.
+	Instance interface{}
+	// Created is set when saving inserts the row
+	Created bool
+	// DB runs queries in the write's transaction, or on the migrated
+	// database for post_migrate
+	DB *gorm.DB
+	// Database names the migrated database, for post_migrate
+	Database string
+	// Models are the migrated models, for post_migrate
+	Models []interface{}
+}
+
+// Receiver handles a signal. Errors are returned by Send; for model writes
+// they abort the write and roll back its transaction.
+type Receiver func(ctx context.Context, e *Event) error
+
+// Signal dispatches events to its connected receivers in the order they
+// were connected
+type Signal struct {
+	name string
+
+	mu        sync.Mutex
+	receivers []*receiver
+}
+
+// receiver is a connected Receiver with its options
+type receiver struct {
+	fn Receiver
+	// sender restricts the receiver to one model type when set
+	sender reflect.Type
+	once   bool
+	// done is set when a once or weak receiver is disconnected
+	done atomic.Bool
+}
+
+// Option configures a connected receiver
+type Option func(r *receiver)
+
+// Sender only delivers events for the model type of model, e.g. &Post{}
+func Sender(model interface{}) Option {
+	return func(r *receiver) {
+		r.sender = modelType(reflect.TypeOf(model))
+	}
+}
+
+// Once disconnects the receiver after its first event
+func Once() Option {
+	return func(r *receiver) {
+		r.once = true
+	}
+}
+
+// Weak disconnects the receiver once owner is garbage collected, so a
+// receiver tied to a short-lived object doesn't outlive it. The receiver
+// must not reference owner, which must be a pointer to an object without
+// a finalizer.
+func Weak(owner interface{}) Option {
+	return func(r *receiver) {
+		runtime.SetFinalizer(owner, func(interface{}) {
+			r.done.Store(true)
+		})
+	}
+}
+
+// New returns a signal with the given name
+func New(name string) *Signal {
+	return &Signal{name: name}
+}
+
+// String returns the signal's name
+func (s *Signal) String() string {
+	return s.name
+}
+
+// Connect registers fn for the signal and returns a function that
+// disconnects it
+func (s *Signal) Connect(fn Receiver, opts ...Option) (disconnect func()) {
+	r := &receiver{fn: fn}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	s.mu.Lock()
+	s.receivers = append(s.receivers, r)
+	s.mu.Unlock()
+
+	return func() {
+		r.done.Store(true)
+		s.remove(r)
+	}
+}
+
+// ConnectModel registers a receiver for writes of model T only, called with
+// each written instance; a batch write calls it once per element
+func ConnectModel[T any](s *Signal, fn func(ctx context.Context, obj *T, e *Event) error, opts ...Option) (disconnect func()) {
+	opts = append(opts, Sender((*T)(nil)))
+	return s.Connect(func(ctx context.Context, e *Event) error {
+		return eachInstance(e.Instance, func(obj *T) error {
+			return fn(ctx, obj, e)
+		})
+	}, opts...)
+}
+
+// remove drops r from the receivers
+func (s *Signal) remove(r *receiver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, other := range s.receivers {
+		if other == r {
+			// Copy so a Send in progress keeps its snapshot intact
+			list := make([]*receiver, 0, len(s.receivers)-1)
+			list = append(list, s.receivers[:i]...)
+			s.receivers = append(list, s.receivers[i+1:]...)
+			return
+		}
+	}
+}
+
+// HasReceivers reports whether any receiver is connected
+func (s *Signal) HasReceivers() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.receivers) > 0
+}
+
+// Send delivers e to the matching receivers, stopping at the first error
+func (s *Signal) Send(ctx context.Context, e *Event) error {
+	s.mu.Lock()
+	list := s.receivers
+	s.mu.Unlock()
+
+	e.Signal = s
+	var sender reflect.Type
+	if e.Instance != nil {
+		sender = modelType(reflect.TypeOf(e.Instance))
+	}
+
+	for _, r := range list {
+		if r.sender != nil && r.sender != sender {
+			continue
+		}
+		if r.done.Load() {
+			s.remove(r)
+			continue
+		}
+		if r.once {
+			// Only the first of concurrent sends delivers to a once receiver
+			if r.done.Swap(true) {
+				continue
+			}
+			s.remove(r)
+		}
+
+		if err := r.fn(ctx, e); err != nil {
+			return fmt.Errorf("%s receiver: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// modelType returns the struct type behind pointers and slices
+func modelType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+// eachInstance calls fn with a pointer to every T in instance, which is a
+// T, a pointer to one, or a slice of either
+func eachInstance[T any](instance interface{}, fn func(obj *T) error) error {
+	v := reflect.ValueOf(instance)
+	for v.Kind() == reflect.Ptr {
+		if obj, ok := v.Interface().(*T); ok {
+			return fn(obj)
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if elem.Kind() != reflect.Ptr && elem.CanAddr() {
+				// Let receivers modify the elements, e.g. in pre_save
+				elem = elem.Addr()
+			}
+			if err := eachInstance(elem.Interface(), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if !v.IsValid() {
+			return nil
+		}
+		obj, ok := v.Interface().(T)
+		if !ok {
+			return nil
+		}
+		return fn(&obj)
+	}
+}
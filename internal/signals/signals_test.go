@@ -0,0 +1,201 @@
+package signals
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type post struct {
+	Title string
+}
+
+type comment struct {
+	Body string
+}
+
+// record returns a receiver appending name to calls
+func record(calls *[]string, name string) Receiver {
+	return func(ctx context.Context, e *Event) error {
+		*calls = append(*calls, name)
+		return nil
+	}
+}
+
+func TestReceiverOrder(t *testing.T) {
+	s := New("test")
+	var calls []string
+	s.Connect(record(&calls, "first"))
+	s.Connect(record(&calls, "second"))
+	s.Connect(record(&calls, "third"))
+
+	if err := s.Send(context.Background(), &Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "first,second,third" {
+		t.Errorf("receivers called in order %s", got)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	s := New("test")
+	var calls []string
+	s.Connect(record(&calls, "kept"))
+	disconnect := s.Connect(record(&calls, "removed"))
+
+	disconnect()
+	// Disconnecting twice is harmless
+	disconnect()
+
+	if err := s.Send(context.Background(), &Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "kept" {
+		t.Errorf("called %s after disconnecting", got)
+	}
+
+	s2 := New("empty")
+	disconnect = s2.Connect(record(&calls, "only"))
+	if !s2.HasReceivers() {
+		t.Error("HasReceivers = false with a receiver connected")
+	}
+	disconnect()
+	if s2.HasReceivers() {
+		t.Error("HasReceivers = true after disconnecting")
+	}
+}
+
+func TestDisconnectDuringSend(t *testing.T) {
+	s := New("test")
+	var calls []string
+	var disconnectSecond func()
+	s.Connect(func(ctx context.Context, e *Event) error {
+		calls = append(calls, "first")
+		disconnectSecond()
+		return nil
+	})
+	disconnectSecond = s.Connect(record(&calls, "second"))
+
+	if err := s.Send(context.Background(), &Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "first" {
+		t.Errorf("called %s; a receiver disconnected during a send must not run", got)
+	}
+}
+
+func TestErrorStopsSend(t *testing.T) {
+	s := New("pre_test")
+	var calls []string
+	s.Connect(record(&calls, "first"))
+	s.Connect(func(ctx context.Context, e *Event) error {
+		return errors.New("rejected")
+	})
+	s.Connect(record(&calls, "after"))
+
+	err := s.Send(context.Background(), &Event{})
+	if err == nil || err.Error() != "pre_test receiver: rejected" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(calls, ","); got != "first" {
+		t.Errorf("called %s; receivers after an error must not run", got)
+	}
+}
+
+func TestSender(t *testing.T) {
+	s := New("test")
+	var calls []string
+	s.Connect(record(&calls, "post"), Sender(&post{}))
+	s.Connect(record(&calls, "any"))
+
+	for _, instance := range []interface{}{&post{}, []post{{}, {}}, &comment{}, nil} {
+		if err := s.Send(context.Background(), &Event{Instance: instance}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(calls, ","); got != "post,any,post,any,any,any" {
+		t.Errorf("calls = %s", got)
+	}
+}
+
+func TestConnectModel(t *testing.T) {
+	s := New("test")
+	var titles []string
+	ConnectModel(s, func(ctx context.Context, p *post, e *Event) error {
+		titles = append(titles, p.Title)
+		// Receivers may modify the instance, e.g. in pre_save
+		p.Title = strings.ToUpper(p.Title)
+		return nil
+	})
+
+	single := &post{Title: "one"}
+	batch := []post{{Title: "two"}, {Title: "three"}}
+	pointers := []*post{{Title: "four"}}
+	for _, instance := range []interface{}{single, &batch, pointers, &comment{Body: "ignored"}} {
+		if err := s.Send(context.Background(), &Event{Instance: instance}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := strings.Join(titles, ","); got != "one,two,three,four" {
+		t.Errorf("received %s", got)
+	}
+	if single.Title != "ONE" || batch[1].Title != "THREE" || pointers[0].Title != "FOUR" {
+		t.Errorf("changes not visible to the sender: %v %v %v", single, batch, pointers[0])
+	}
+}
+
+func TestOnce(t *testing.T) {
+	s := New("test")
+	var calls []string
+	s.Connect(record(&calls, "once"), Once())
+
+	for i := 0; i < 3; i++ {
+		if err := s.Send(context.Background(), &Event{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(calls) != 1 {
+		t.Errorf("once receiver called %d times", len(calls))
+	}
+	if s.HasReceivers() {
+		t.Error("once receiver still connected")
+	}
+}
+
+// owner is large enough to get its own allocation, so its finalizer runs
+type owner struct {
+	name string
+	next *owner
+}
+
+func TestWeak(t *testing.T) {
+	s := New("test")
+	calls := 0
+	s.Connect(func(ctx context.Context, e *Event) error {
+		calls++
+		return nil
+	}, Weak(&owner{name: "short-lived"}))
+
+	// Finalizers run in the background after a collection
+	for i := 0; i < 20 && s.HasReceivers(); i++ {
+		runtime.GC()
+		runtime.Gosched()
+		if err := s.Send(context.Background(), &Event{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.HasReceivers() {
+		t.Fatal("weak receiver still connected after its owner was collected")
+	}
+
+	before := calls
+	if err := s.Send(context.Background(), &Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != before {
+		t.Error("weak receiver called after its owner was collected")
+	}
+}
@@ -0,0 +1,294 @@
+// Package factory builds model instances for tests from per-model
+// definitions, in an isolated database per test.
+package factory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"going/internal/config"
+	"going/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Fields overrides values of a built instance, keyed by Go field name or
+// column name
+type Fields map[string]interface{}
+
+// Definition describes how to build instances of a model
+type Definition[T any] struct {
+	// Defaults fills a new instance
+	Defaults func(b *Builder, obj *T)
+	// Associations return the related instance, or its pointer, for the
+	// named fields. They run after Defaults and are skipped for fields that
+	// are overridden.
+	Associations map[string]func(b *Builder) interface{}
+	// Traits are named variations applied after the defaults, e.g. "admin"
+	Traits map[string]func(b *Builder, obj *T)
+}
+
+// Builder is passed to the functions of a definition while an instance is
+// built
+type Builder struct {
+	// T is the test the instance is built for
+	T testing.TB
+	// DB is the test database
+	DB *database.DB
+	// Seq numbers the instances of a model, starting at 1. It is unique for
+	// the life of the process, so it can fill unique columns.
+	Seq int
+}
+
+var (
+	mu          sync.Mutex
+	definitions = make(map[reflect.Type]interface{})
+	databases   = make(map[testing.TB]*database.DB)
+	// sequences number the instances of each model; they survive Define,
+	// so redefining a factory doesn't reuse numbers
+	sequences = make(map[reflect.Type]int)
+)
+
+// Define registers the factory of a model, replacing any previous one.
+// Sequence numbers carry on from the previous factory.
+// Models without a factory are built from their zero value.
+func Define[T any](def *Definition[T]) {
+	mu.Lock()
+	defer mu.Unlock()
+	definitions[reflect.TypeOf((*T)(nil)).Elem()] = def
+}
+
+// definition returns the factory of T, or an empty one
+func definition[T any]() *Definition[T] {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if def, ok := definitions[t]; ok {
+		return def.(*Definition[T])
+	}
+	def := &Definition[T]{}
+	definitions[t] = def
+	return def
+}
+
+// nextSeq returns the next sequence number of T
+func nextSeq[T any]() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	sequences[t]++
+	return sequences[t]
+}
+
+// DB returns the test's database: an in-memory SQLite database with every
+// registered model migrated, opened on first use and closed when the test
+// ends. Subtests get their own database unless given one with Use. Pass it
+// to code under test with database.NewContext.
+func DB(t testing.TB) *database.DB {
+	t.Helper()
+
+	mu.Lock()
+	db, ok := databases[t]
+	mu.Unlock()
+	if ok {
+		return db
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Database.Name = ":memory:"
+	cfg.Database.AutoMigrate = true
+	cfg.Database.LogLevel = "error"
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatalf("factory: failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	Use(t, db)
+	return db
+}
+
+// Use makes factories create the test's instances in db, e.g. to share the
+// parent test's database with a subtest or to run against PostgreSQL
+func Use(t testing.TB, db *database.DB) {
+	mu.Lock()
+	databases[t] = db
+	mu.Unlock()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(databases, t)
+		mu.Unlock()
+	})
+}
+
+// Build returns a new instance of T without saving it: the defaults, then
+// the traits in order, then overrides are applied. Associations are
+// created in the database.
+func Build[T any](t testing.TB, overrides Fields, traits ...string) *T {
+	t.Helper()
+
+	def := definition[T]()
+	db := DB(t)
+	b := &Builder{T: t, DB: db, Seq: nextSeq[T]()}
+
+	obj := new(T)
+	if def.Defaults != nil {
+		def.Defaults(b, obj)
+	}
+
+	s, err := parse(db, obj)
+	if err != nil {
+		t.Fatalf("factory: %v", err)
+	}
+
+	for name, associate := range def.Associations {
+		if overridden(s, overrides, name) {
+			continue
+		}
+		if err := set(s, obj, name, associate(b)); err != nil {
+			t.Fatalf("factory: association %s of %T: %v", name, obj, err)
+		}
+	}
+
+	for _, name := range traits {
+		trait, ok := def.Traits[name]
+		if !ok {
+			t.Fatalf("factory: unknown trait %q for %T", name, obj)
+		}
+		trait(b, obj)
+	}
+
+	for name, value := range overrides {
+		if err := set(s, obj, name, value); err != nil {
+			t.Fatalf("factory: override %s of %T: %v", name, obj, err)
+		}
+	}
+
+	for _, rel := range s.Relationships.BelongsTo {
+		setForeignKeys(obj, rel)
+	}
+
+	return obj
+}
+
+// Create builds an instance of T like Build and saves it in the test's
+// database
+func Create[T any](t testing.TB, overrides Fields, traits ...string) *T {
+	t.Helper()
+
+	obj := Build[T](t, overrides, traits...)
+	conn, err := DB(t).For(obj)
+	if err != nil {
+		t.Fatalf("factory: %v", err)
+	}
+	if err := conn.Create(obj).Error; err != nil {
+		t.Fatalf("factory: failed to create %T: %v", obj, err)
+	}
+	return obj
+}
+
+// CreateBatch creates n instances of T with the same overrides and traits
+func CreateBatch[T any](t testing.TB, n int, overrides Fields, traits ...string) []*T {
+	t.Helper()
+
+	list := make([]*T, n)
+	for i := range list {
+		list[i] = Create[T](t, overrides, traits...)
+	}
+	return list
+}
+
+// parse returns the schema of a model
+func parse(db *database.DB, obj interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db.Default()}
+	if err := stmt.Parse(obj); err != nil {
+		return nil, fmt.Errorf("failed to parse model %T: %w", obj, err)
+	}
+	return stmt.Schema, nil
+}
+
+// overridden reports whether overrides sets the named field or, for a
+// belongs-to association, its foreign key
+func overridden(s *schema.Schema, overrides Fields, name string) bool {
+	fields := make([]*schema.Field, 0)
+	if field := s.LookUpField(name); field != nil {
+		fields = append(fields, field)
+		if rel, ok := s.Relationships.Relations[field.Name]; ok && rel.Type == schema.BelongsTo {
+			for _, ref := range rel.References {
+				fields = append(fields, ref.ForeignKey)
+			}
+		}
+	}
+
+	for key := range overrides {
+		if key == name {
+			return true
+		}
+		for _, field := range fields {
+			if s.LookUpField(key) == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setForeignKeys copies the primary key of a belongs-to association into
+// the foreign key, so built instances refer to their associations
+func setForeignKeys(obj interface{}, rel *schema.Relationship) {
+	ctx := context.Background()
+	row := reflect.ValueOf(obj).Elem()
+	related := reflect.Indirect(rel.Field.ReflectValueOf(ctx, row))
+	if !related.IsValid() {
+		return
+	}
+
+	for _, ref := range rel.References {
+		if ref.PrimaryKey == nil {
+			continue
+		}
+		if value, zero := ref.PrimaryKey.ValueOf(ctx, related); !zero {
+			ref.ForeignKey.Set(ctx, row, value)
+		}
+	}
+}
+
+// set assigns value to the named field of obj, dereferencing or taking the
+// address of value and converting it as needed, e.g. an int to a uint
+func set(s *schema.Schema, obj interface{}, name string, value interface{}) error {
+	field := s.LookUpField(name)
+	if field == nil {
+		return fmt.Errorf("unknown field")
+	}
+	target := field.ReflectValueOf(context.Background(), reflect.ValueOf(obj).Elem())
+
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(target.Type()):
+	case v.Kind() == reflect.Ptr && v.Type().Elem().AssignableTo(target.Type()):
+		v = v.Elem()
+	case target.Kind() == reflect.Ptr && v.Type().AssignableTo(target.Type().Elem()):
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	case v.Type().ConvertibleTo(target.Type()):
+		v = v.Convert(target.Type())
+	default:
+		return fmt.Errorf("cannot use %T as %s", value, target.Type())
+	}
+	target.Set(v)
+	return nil
+}
@@ -0,0 +1,208 @@
+package factory
+
+import (
+	"fmt"
+	"testing"
+
+	"going/internal/database"
+)
+
+// writer and article are test models; an article belongs to its writer
+type writer struct {
+	ID    uint `gorm:"primaryKey"`
+	Name  string
+	Email string `gorm:"uniqueIndex"`
+	Admin bool
+}
+
+type article struct {
+	ID       uint `gorm:"primaryKey"`
+	Title    string
+	Views    uint
+	WriterID uint
+	Writer   *writer
+}
+
+func init() {
+	database.RegisterModels(&writer{}, &article{})
+
+	Define(&Definition[writer]{
+		Defaults: func(b *Builder, w *writer) {
+			w.Name = "Writer"
+			w.Email = fmt.Sprintf("writer%d@example.com", b.Seq)
+		},
+		Traits: map[string]func(b *Builder, w *writer){
+			"admin": func(b *Builder, w *writer) {
+				w.Admin = true
+				w.Name = "Admin"
+			},
+		},
+	})
+	Define(&Definition[article]{
+		Defaults: func(b *Builder, a *article) {
+			a.Title = fmt.Sprintf("Article %d", b.Seq)
+		},
+		Associations: map[string]func(b *Builder) interface{}{
+			"Writer": func(b *Builder) interface{} {
+				return Create[writer](b.T, nil)
+			},
+		},
+	})
+}
+
+// count returns the number of rows of model T in the test's database
+func count[T any](t *testing.T) int64 {
+	t.Helper()
+
+	var n int64
+	if err := DB(t).Default().Model(new(T)).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSequences(t *testing.T) {
+	first := Build[writer](t, nil)
+	second := Build[writer](t, nil)
+
+	if first.Email == second.Email {
+		t.Errorf("both writers got email %s", first.Email)
+	}
+	var n1, n2 int
+	fmt.Sscanf(first.Email, "writer%d@", &n1)
+	fmt.Sscanf(second.Email, "writer%d@", &n2)
+	if n2 != n1+1 {
+		t.Errorf("sequence went from %d to %d", n1, n2)
+	}
+	if got := count[writer](t); got != 0 {
+		t.Errorf("Build saved %d writers", got)
+	}
+}
+
+func TestOverridesAndTraits(t *testing.T) {
+	w := Create[writer](t, Fields{"Name": "Ada", "email": "ada@example.com"})
+	if w.Name != "Ada" || w.Email != "ada@example.com" {
+		t.Errorf("overrides by field and column name not applied: %+v", w)
+	}
+
+	// Traits apply after the defaults, overrides after the traits
+	admin := Build[writer](t, Fields{"Name": "Grace"}, "admin")
+	if !admin.Admin || admin.Name != "Grace" {
+		t.Errorf("expected an admin named Grace, got %+v", admin)
+	}
+
+	// Values are converted to the field's type
+	a := Build[article](t, Fields{"Views": 42, "Title": "Converted"})
+	if a.Views != 42 || a.Title != "Converted" {
+		t.Errorf("override not converted: %+v", a)
+	}
+
+	var stored writer
+	if err := DB(t).Default().First(&stored, w.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "Ada" {
+		t.Errorf("stored writer is named %q", stored.Name)
+	}
+}
+
+func TestCreateBatch(t *testing.T) {
+	list := CreateBatch[writer](t, 3, Fields{"Name": "Batch"}, "admin")
+	if len(list) != 3 {
+		t.Fatalf("created %d writers, want 3", len(list))
+	}
+
+	emails := make(map[string]bool)
+	for _, w := range list {
+		if w.ID == 0 || w.Name != "Batch" || !w.Admin {
+			t.Errorf("unexpected writer %+v", w)
+		}
+		emails[w.Email] = true
+	}
+	if len(emails) != 3 {
+		t.Errorf("batch reused emails: %v", emails)
+	}
+	if got := count[writer](t); got != 3 {
+		t.Errorf("database has %d writers, want 3", got)
+	}
+}
+
+func TestAssociations(t *testing.T) {
+	// The association factory creates the writer and sets the foreign key
+	a := Create[article](t, nil)
+	if a.Writer == nil || a.Writer.ID == 0 || a.WriterID != a.Writer.ID {
+		t.Fatalf("article not linked to a created writer: %+v", a)
+	}
+
+	// Overriding the association or its foreign key skips the factory
+	existing := Create[writer](t, Fields{"Name": "Existing"})
+	byObject := Create[article](t, Fields{"Writer": existing})
+	byKey := Create[article](t, Fields{"WriterID": existing.ID})
+	if byObject.WriterID != existing.ID || byKey.WriterID != existing.ID {
+		t.Errorf("articles point to writers %d and %d, want %d", byObject.WriterID, byKey.WriterID, existing.ID)
+	}
+	if byKey.Writer != nil {
+		t.Errorf("association built although its key was given: %+v", byKey.Writer)
+	}
+	if got := count[writer](t); got != 2 {
+		t.Errorf("database has %d writers, want 2", got)
+	}
+
+	// Sub-factories can be called from a definition or a test alike
+	articles := CreateBatch[article](t, 2, Fields{"Writer": existing})
+	var n int64
+	if err := DB(t).Default().Model(&article{}).Where("writer_id = ?", existing.ID).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || len(articles) != 2 {
+		t.Errorf("existing writer has %d articles, want 4", n)
+	}
+}
+
+func TestDatabasePerTest(t *testing.T) {
+	Create[writer](t, nil)
+
+	t.Run("isolated", func(t *testing.T) {
+		if got := count[writer](t); got != 0 {
+			t.Errorf("subtest sees %d writers of its parent", got)
+		}
+	})
+
+	parent := DB(t)
+	t.Run("shared", func(t *testing.T) {
+		Use(t, parent)
+		Create[writer](t, nil)
+		if got := count[writer](t); got != 2 {
+			t.Errorf("subtest sees %d writers, want 2", got)
+		}
+	})
+}
+
+// counter is only defined by TestRedefineKeepsSequence
+type counter struct {
+	ID   uint
+	Code string
+}
+
+func TestRedefineKeepsSequence(t *testing.T) {
+	define := func(prefix string) {
+		Define(&Definition[counter]{
+			Defaults: func(b *Builder, c *counter) {
+				c.Code = fmt.Sprintf("%s-%d", prefix, b.Seq)
+			},
+		})
+	}
+
+	define("a")
+	first := Build[counter](t, nil)
+	// A later test replacing the factory must not reuse sequence numbers
+	define("b")
+	second := Build[counter](t, nil)
+
+	var n1, n2 int
+	fmt.Sscanf(first.Code, "a-%d", &n1)
+	fmt.Sscanf(second.Code, "b-%d", &n2)
+	if n2 <= n1 {
+		t.Errorf("sequence restarted after Define: %s then %s", first.Code, second.Code)
+	}
+}